@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangrier/alien/pkg/config"
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes for the check command
+const (
+	exitCheckFailed = 1
+	exitCheckError  = 2
+)
+
+var cmdCheck = &cobra.Command{
+	Use:   "check [endpoint...]",
+	Short: "check each probe once and exit non-zero if any fail",
+	Long: `Check triggers every probe once, in parallel, prints the results
+and exits with status 1 if any probe failed, or 2 if the probes
+could not be set up. Probes are given as endpoints expecting a
+HTTP 200 response, or loaded with --config.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 && checkFlags.config == "" {
+			cmd.Usage()
+			os.Exit(exitCheckError)
+		}
+		if checkFlags.output != "table" && checkFlags.output != "json" {
+			fmt.Fprintf(os.Stderr, "Error: unknown output format %q\n", checkFlags.output)
+			cmd.Usage()
+			os.Exit(exitCheckError)
+		}
+		os.Exit(check(args))
+	},
+}
+
+var checkFlags struct {
+	config  string
+	timeout time.Duration
+	output  string
+	verbose bool
+}
+
+func init() {
+	rootCmd.AddCommand(cmdCheck)
+
+	cmdCheck.Flags().StringVar(&checkFlags.config, "config", "", "file to load probe definitions from")
+	cmdCheck.Flags().DurationVar(&checkFlags.timeout, "timeout", 30*time.Second, "maximum time to wait for all probes")
+	cmdCheck.Flags().StringVarP(&checkFlags.output, "output", "o", "table", "output format, table or json")
+	cmdCheck.Flags().BoolVarP(&checkFlags.verbose, "verbose", "v", false, "show probe logs")
+}
+
+// checkResult is the JSON output for a single probe check
+type checkResult struct {
+	Probe     string            `json:"probe"`
+	Endpoint  string            `json:"endpoint"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Success   bool              `json:"success"`
+	Code      int               `json:"code,omitempty"`
+	LatencyMS float64           `json:"latency_ms"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// check runs every probe once and returns the exit code
+func check(endpoints []string) int {
+	var logger = log.New(ioutil.Discard, "", 0)
+	if checkFlags.verbose {
+		logger = log.New(os.Stderr, "", 0)
+	}
+
+	probes, err := checkProbes(endpoints, probe.WithLogger(logger))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCheckError
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkFlags.timeout)
+	defer cancel()
+
+	results := make([]checkResult, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, p *probe.Probe) {
+			defer wg.Done()
+			results[i] = checkResult{
+				Probe:    p.String(),
+				Endpoint: p.Endpoint(),
+				Labels:   p.Labels(),
+			}
+			res, err := p.Check(ctx)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Success = res.Success
+			results[i].Code = res.Code
+			results[i].LatencyMS = float64(res.Latency) / float64(time.Millisecond)
+			if res.Error != nil {
+				results[i].Error = res.Error.Error()
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	switch checkFlags.output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(results)
+	case "table":
+		err = printCheckTable(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCheckError
+	}
+
+	for _, r := range results {
+		if !r.Success {
+			return exitCheckFailed
+		}
+	}
+	return 0
+}
+
+// checkProbes creates the probes from the config file if given,
+// and for each endpoint argument
+func checkProbes(endpoints []string, extra ...probe.Option) ([]*probe.Probe, error) {
+	var probes []*probe.Probe
+
+	if checkFlags.config != "" {
+		c, err := config.Load(checkFlags.config)
+		if err != nil {
+			return nil, err
+		}
+		if probes, err = c.NewProbes(extra...); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ep := range endpoints {
+		p, err := probe.New(ep, append(extra, probe.WithSuccessFilter(probe.FilterResponseCode(200)))...)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, p)
+	}
+
+	return probes, nil
+}
+
+// printCheckTable writes the results as an aligned table
+func printCheckTable(w io.Writer, results []checkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tENDPOINT\tCODE\tLATENCY\tERROR")
+	for _, r := range results {
+		status := "FAIL"
+		if r.Success {
+			status = "OK"
+		}
+		code := "-"
+		if r.Code != 0 {
+			code = fmt.Sprint(r.Code)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.1fms\t%s\n", status, r.Endpoint, code, r.LatencyMS, r.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dangrier/alien/pkg/config"
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/spf13/cobra"
+)
+
+var cmdFilter = &cobra.Command{
+	Use:   "filter",
+	Short: "work with result filters",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var cmdFilterTest = &cobra.Command{
+	Use:   "test",
+	Short: "test a filter against a live or saved response",
+	Long: `Test fetches a response from --url, or loads a saved raw HTTP
+response from --response, then checks the filter given by --expr
+against it and prints the outcome of each clause. The filter is
+written in the same JSON form as configuration files, for example:
+
+  alien filter test --url http://localhost/health \
+    --expr '{"all": [{"code": 200}, {"contains": "ok"}]}'
+
+Exits with status 1 if the filter does not pass.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if filterFlags.expr == "" || (filterFlags.url == "") == (filterFlags.response == "") {
+			cmd.Usage()
+			os.Exit(exitCheckError)
+		}
+		os.Exit(filterTest())
+	},
+}
+
+var filterFlags struct {
+	expr     string
+	url      string
+	response string
+	method   string
+	headers  []string
+	payload  string
+	timeout  time.Duration
+}
+
+func init() {
+	rootCmd.AddCommand(cmdFilter)
+	cmdFilter.AddCommand(cmdFilterTest)
+
+	cmdFilterTest.Flags().StringVar(&filterFlags.expr, "expr", "", "filter to test, in configuration JSON form")
+	cmdFilterTest.Flags().StringVar(&filterFlags.url, "url", "", "endpoint to fetch the response from")
+	cmdFilterTest.Flags().StringVar(&filterFlags.response, "response", "", "file containing a saved raw HTTP response")
+	cmdFilterTest.Flags().StringVarP(&filterFlags.method, "method", "X", "GET", "HTTP method used with --url")
+	cmdFilterTest.Flags().StringArrayVarP(&filterFlags.headers, "header", "H", nil, "request header used with --url, as 'Name: value'")
+	cmdFilterTest.Flags().StringVarP(&filterFlags.payload, "data", "d", "", "request body used with --url")
+	cmdFilterTest.Flags().DurationVar(&filterFlags.timeout, "timeout", 10*time.Second, "timeout for fetching --url")
+}
+
+// filterTest checks the filter and returns the exit code
+func filterTest() int {
+	filter, err := config.ParseFilter(filterFlags.expr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --expr: %v\n", err)
+		return exitCheckError
+	}
+
+	var res *probe.Result
+	if filterFlags.url != "" {
+		res, err = fetchResult(filter)
+	} else {
+		res, err = loadResult(filterFlags.response)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCheckError
+	}
+
+	fmt.Printf("Response: %d, %d bytes\n\n", res.Code, len(res.Body))
+
+	e := probe.Explain(filter, res)
+	printExplanation(os.Stdout, e, 0)
+
+	if !e.Pass {
+		return exitCheckFailed
+	}
+	return 0
+}
+
+// fetchResult makes a live request using a one-off probe
+func fetchResult(filter probe.ResultFilter) (*probe.Result, error) {
+	options := []probe.Option{
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithMethod(filterFlags.method),
+		probe.WithPayload(filterFlags.payload),
+		probe.WithSuccessFilter(filter),
+	}
+	for _, h := range filterFlags.headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("--header %q: must be 'Name: value'", h)
+		}
+		options = append(options, probe.WithHeader(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])))
+	}
+
+	p, err := probe.New(filterFlags.url, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), filterFlags.timeout)
+	defer cancel()
+
+	res, err := p.Check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res, res.Error
+}
+
+// loadResult reads a saved raw HTTP response into a Result
+func loadResult(path string) (*probe.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	resp, err := http.ReadResponse(bufio.NewReader(f), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return &probe.Result{
+		Timestamp: time.Now(),
+		Code:      resp.StatusCode,
+		Headers:   resp.Header,
+		Body:      string(body),
+	}, nil
+}
+
+// printExplanation writes the outcome of each clause as an
+// indented tree
+func printExplanation(w io.Writer, e probe.Explanation, depth int) {
+	outcome := "FAIL"
+	if e.Pass {
+		outcome = "PASS"
+	}
+
+	fmt.Fprintf(w, "%s%s  %s\n", strings.Repeat("  ", depth), outcome, clause(e.Filter))
+	for _, m := range e.Members {
+		printExplanation(w, m, depth+1)
+	}
+}
+
+// clause describes a single filter without its members
+func clause(f probe.ResultFilter) string {
+	switch f.(type) {
+	case probe.FilterGroupAll:
+		return "all of"
+	case probe.FilterGroupAny:
+		return "any of"
+	case probe.FilterGroupNot:
+		return "not"
+	}
+	return fmt.Sprint(f)
+}
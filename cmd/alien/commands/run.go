@@ -1,7 +1,15 @@
 package commands
 
 import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/dangrier/alien/pkg/alien"
+	"github.com/dangrier/alien/pkg/config"
+	"github.com/dangrier/alien/pkg/notify"
 	"github.com/dangrier/alien/pkg/probe"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -11,7 +19,7 @@ var cmdRun = &cobra.Command{
 	Use:   "run",
 	Short: "run a single probe with default settings and looking for a HTTP 200 response",
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 1 {
+		if len(args) < 1 && runFlags.config == "" {
 			cmd.Usage()
 			return
 		}
@@ -19,24 +27,251 @@ var cmdRun = &cobra.Command{
 	},
 }
 
+var runFlags struct {
+	config string
+	labels map[string]string
+
+	listen      string
+	metricsPath string
+	tlsCert     string
+	tlsKey      string
+	clientCA    string
+	authUser    string
+}
+
+var webhookFlags struct {
+	url        string
+	template   string
+	timeout    time.Duration
+	retries    int
+	backoff    time.Duration
+	deadLetter string
+}
+
+var alertmanagerFlags struct {
+	url    string
+	resend time.Duration
+	labels map[string]string
+}
+
+var emailFlags struct {
+	addr     string
+	from     string
+	to       []string
+	user     string
+	startTLS bool
+	digest   time.Duration
+	subject  string
+	text     string
+	html     string
+}
+
 func init() {
 	rootCmd.AddCommand(cmdRun)
+
+	cmdRun.Flags().StringVar(&runFlags.config, "config", "", "file to load probe and module definitions from")
+	cmdRun.Flags().StringToStringVar(&runFlags.labels, "label", nil, "label to add to every probe's metrics and notifications, as name=value")
+
+	cmdRun.Flags().StringVar(&runFlags.listen, "listen", ":8080", "address and port for the metrics and admin server")
+	cmdRun.Flags().StringVar(&runFlags.metricsPath, "metrics-path", "/metrics", "path to serve metrics on")
+	cmdRun.Flags().StringVar(&runFlags.tlsCert, "tls-cert", "", "certificate file to serve metrics over HTTPS")
+	cmdRun.Flags().StringVar(&runFlags.tlsKey, "tls-key", "", "key file to serve metrics over HTTPS")
+	cmdRun.Flags().StringVar(&runFlags.clientCA, "tls-client-ca", "", "require client certificates signed by a CA in this file")
+	cmdRun.Flags().StringVar(&runFlags.authUser, "basic-auth-user", "", "require basic authentication with this username, and the password in ALIEN_BASIC_AUTH_PASSWORD")
+
+	cmdRun.Flags().StringVar(&webhookFlags.url, "webhook-url", "", "POST a JSON payload to this URL when a probe fails or recovers, signed with HMAC-SHA256 using ALIEN_WEBHOOK_SECRET if set")
+	cmdRun.Flags().StringVar(&webhookFlags.template, "webhook-template", "", "file containing a text/template for the webhook payload")
+	cmdRun.Flags().DurationVar(&webhookFlags.timeout, "webhook-timeout", 10*time.Second, "timeout for each webhook delivery attempt")
+	cmdRun.Flags().IntVar(&webhookFlags.retries, "webhook-retries", 3, "number of times to retry a failed webhook delivery")
+	cmdRun.Flags().DurationVar(&webhookFlags.backoff, "webhook-backoff", time.Second, "wait before the first webhook retry, doubling each retry")
+	cmdRun.Flags().StringVar(&webhookFlags.deadLetter, "webhook-dead-letter", "", "file to append undeliverable webhook payloads to")
+
+	cmdRun.Flags().StringVar(&alertmanagerFlags.url, "alertmanager-url", "", "push alerts to the Alertmanager at this base URL when a probe is down")
+	cmdRun.Flags().DurationVar(&alertmanagerFlags.resend, "alertmanager-resend", time.Minute, "how often to re-send alerts while a probe stays down")
+	cmdRun.Flags().StringToStringVar(&alertmanagerFlags.labels, "alertmanager-label", nil, "extra label to add to alerts, as name=value")
+
+	cmdRun.Flags().StringVar(&emailFlags.addr, "smtp-addr", "", "send email through the SMTP server at host:port when probes change state")
+	cmdRun.Flags().StringVar(&emailFlags.from, "smtp-from", "", "sender address for emails")
+	cmdRun.Flags().StringSliceVar(&emailFlags.to, "smtp-to", nil, "recipient addresses for emails")
+	cmdRun.Flags().StringVar(&emailFlags.user, "smtp-user", "", "SMTP username, with the password in ALIEN_SMTP_PASSWORD")
+	cmdRun.Flags().BoolVar(&emailFlags.startTLS, "smtp-starttls", false, "require the SMTP connection to use STARTTLS")
+	cmdRun.Flags().DurationVar(&emailFlags.digest, "smtp-digest", 30*time.Second, "batch state changes within this window into one email")
+	cmdRun.Flags().StringVar(&emailFlags.subject, "smtp-subject", "", "text/template for the email subject")
+	cmdRun.Flags().StringVar(&emailFlags.text, "smtp-text-template", "", "file containing a text/template for the plain text body")
+	cmdRun.Flags().StringVar(&emailFlags.html, "smtp-html-template", "", "file containing an html/template for the HTML body")
 }
 
 func run(endpoints []string) {
-	a := alien.New()
+	a, err := newAlien()
+	if err != nil {
+		logrus.Fatalf("New alien: %v", err)
+	}
 
-	for _, ep := range endpoints {
-		p, err := probe.New(ep, probe.WithSuccessFilter(probe.FilterResponseCode(200)))
+	options := []probe.Option{
+		probe.WithLabels(runFlags.labels),
+	}
+
+	// Notifiers with deliveries which may still be in progress when
+	// the probes are stopped
+	var notifiers []interface{ Wait() }
+
+	if webhookFlags.url != "" {
+		w, err := newWebhook()
 		if err != nil {
+			logrus.Fatalf("New webhook: %v", err)
+		}
+		options = append(options, w.Options()...)
+		notifiers = append(notifiers, w)
+	}
+
+	if alertmanagerFlags.url != "" {
+		am, err := notify.NewAlertmanager(alertmanagerFlags.url,
+			notify.WithAlertResend(alertmanagerFlags.resend),
+			notify.WithAlertLabels(alertmanagerFlags.labels),
+		)
+		if err != nil {
+			logrus.Fatalf("New alertmanager: %v", err)
+		}
+		options = append(options, am.Options()...)
+		notifiers = append(notifiers, am)
+	}
+
+	var email *notify.Email
+	if emailFlags.addr != "" {
+		if email, err = newEmail(); err != nil {
+			logrus.Fatalf("New email: %v", err)
+		}
+		options = append(options, email.Options()...)
+		notifiers = append(notifiers, email)
+	}
+
+	var probes []*probe.Probe
+
+	if runFlags.config != "" {
+		c, err := config.Load(runFlags.config)
+		if err != nil {
+			logrus.Fatalf("Load config: %v", err)
+		}
+		if probes, err = c.NewProbes(options...); err != nil {
 			logrus.Fatalf("New probe: %v", err)
 		}
+		if err := c.AddModules(a); err != nil {
+			logrus.Fatalf("Add module: %v", err)
+		}
+	}
 
-		err = a.AddProbe(p)
+	for _, ep := range endpoints {
+		p, err := probe.New(ep, append(options, probe.WithSuccessFilter(probe.FilterResponseCode(200)))...)
 		if err != nil {
+			logrus.Fatalf("New probe: %v", err)
+		}
+		probes = append(probes, p)
+	}
+
+	for _, p := range probes {
+		if err := a.AddProbe(p); err != nil {
 			logrus.Fatalf("Add probe: %v", err)
 		}
 	}
 
-	a.Run()
+	err = a.Run()
+
+	// Send any digest still batched rather than dropping its events,
+	// then let every delivery finish before exiting
+	if email != nil {
+		email.Flush()
+	}
+	for _, n := range notifiers {
+		n.Wait()
+	}
+
+	if err != nil {
+		logrus.Fatalf("Run: %v", err)
+	}
+}
+
+// newAlien builds an Alien from the command line flags
+func newAlien() (*alien.Alien, error) {
+	host, port, err := net.SplitHostPort(runFlags.listen)
+	if err != nil {
+		return nil, err
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []alien.Option{
+		alien.WithMetricsAddress(host, portNum),
+		alien.WithMetricsEndpoint(runFlags.metricsPath),
+	}
+	if runFlags.tlsCert != "" || runFlags.tlsKey != "" {
+		options = append(options, alien.WithTLS(runFlags.tlsCert, runFlags.tlsKey))
+	}
+	if runFlags.clientCA != "" {
+		options = append(options, alien.WithClientCA(runFlags.clientCA))
+	}
+	if runFlags.authUser != "" {
+		options = append(options, alien.WithBasicAuth(runFlags.authUser, os.Getenv("ALIEN_BASIC_AUTH_PASSWORD")))
+	}
+
+	return alien.NewWithOptions(options...)
+}
+
+// newWebhook builds a webhook notifier from the command line flags
+func newWebhook() (*notify.Webhook, error) {
+	options := []notify.WebhookOption{
+		notify.WithWebhookSecret(os.Getenv("ALIEN_WEBHOOK_SECRET")),
+		notify.WithWebhookTimeout(webhookFlags.timeout),
+		notify.WithWebhookRetries(webhookFlags.retries, webhookFlags.backoff),
+	}
+
+	if webhookFlags.template != "" {
+		text, err := ioutil.ReadFile(webhookFlags.template)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, notify.WithWebhookTemplate(string(text)))
+	}
+
+	if webhookFlags.deadLetter != "" {
+		f, err := os.OpenFile(webhookFlags.deadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, notify.WithWebhookDeadLetter(f))
+	}
+
+	return notify.NewWebhook(webhookFlags.url, options...)
+}
+
+// newEmail builds an email notifier from the command line flags
+func newEmail() (*notify.Email, error) {
+	options := []notify.EmailOption{
+		notify.WithEmailDigest(emailFlags.digest),
+	}
+
+	if emailFlags.user != "" {
+		options = append(options, notify.WithEmailAuth(emailFlags.user, os.Getenv("ALIEN_SMTP_PASSWORD")))
+	}
+
+	if emailFlags.startTLS {
+		options = append(options, notify.WithEmailStartTLS(nil))
+	}
+
+	var text, html []byte
+	var err error
+	if emailFlags.text != "" {
+		if text, err = ioutil.ReadFile(emailFlags.text); err != nil {
+			return nil, err
+		}
+	}
+	if emailFlags.html != "" {
+		if html, err = ioutil.ReadFile(emailFlags.html); err != nil {
+			return nil, err
+		}
+	}
+	options = append(options, notify.WithEmailTemplates(emailFlags.subject, string(text), string(html)))
+
+	return notify.NewEmail(emailFlags.addr, emailFlags.from, emailFlags.to, options...)
 }
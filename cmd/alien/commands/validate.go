@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dangrier/alien/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var cmdValidate = &cobra.Command{
+	Use:   "validate <config>...",
+	Short: "check probe configuration files for problems",
+	Long: `Validate parses each configuration file, validates every probe and
+reports problems such as unknown fields, duplicate endpoints, very
+low frequencies and success filters which can never match. Exits
+with status 1 if any issues are found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			cmd.Usage()
+			os.Exit(exitCheckError)
+		}
+		os.Exit(validate(args))
+	},
+}
+
+var validateFlags struct {
+	minFrequency time.Duration
+}
+
+func init() {
+	rootCmd.AddCommand(cmdValidate)
+
+	cmdValidate.Flags().DurationVar(&validateFlags.minFrequency, "min-frequency", config.DefaultMinFrequency, "lowest probe frequency to accept")
+}
+
+// validate lints each file and returns the exit code
+func validate(files []string) int {
+	l := config.NewLinter()
+	l.MinFrequency = validateFlags.minFrequency
+
+	code := 0
+	for _, f := range files {
+		issues, err := l.LintFile(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCheckError
+		}
+		for _, i := range issues {
+			fmt.Println(i)
+		}
+		if len(issues) > 0 {
+			code = exitCheckFailed
+		}
+	}
+	return code
+}
@@ -0,0 +1,57 @@
+package alien
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// probeInfo is the admin API representation of a probe
+type probeInfo struct {
+	Probe    string            `json:"probe"`
+	Endpoint string            `json:"endpoint"`
+	Labels   map[string]string `json:"labels"`
+}
+
+// Probes returns the managed probes which have all the labels
+// in the selector. An empty selector returns every probe.
+func (a *Alien) Probes(selector map[string]string) []*probe.Probe {
+	a.processing.Lock()
+	defer a.processing.Unlock()
+
+	var probes []*probe.Probe
+	for p := range a.probes {
+		if p.MatchLabels(selector) {
+			probes = append(probes, p)
+		}
+	}
+	return probes
+}
+
+// handleProbes lists the managed probes as JSON, filtered by any
+// number of label=name=value query parameters
+func (a *Alien) handleProbes(w http.ResponseWriter, r *http.Request) {
+	selector := make(map[string]string)
+	for _, l := range r.URL.Query()["label"] {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			http.Error(w, "label must be name=value", http.StatusBadRequest)
+			return
+		}
+		selector[kv[0]] = kv[1]
+	}
+
+	infos := []probeInfo{}
+	for _, p := range a.Probes(selector) {
+		infos = append(infos, probeInfo{
+			Probe:    p.String(),
+			Endpoint: p.Endpoint(),
+			Labels:   p.Labels(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
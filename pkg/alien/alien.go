@@ -1,30 +1,49 @@
 package alien
 
 import (
-	"fmt"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dangrier/alien/pkg/probe"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
+// probesEndpoint is the admin API path listing managed probes
+const probesEndpoint = "/api/v1/probes"
+
 // Alien is the controller for a set of configured probes
 type Alien struct {
+	heartbeat int64 // unix nanoseconds, accessed atomically so kept 64-bit aligned
+
 	init       bool
 	probes     map[*probe.Probe]bool
+	modules    map[string]Module
 	results    chan probe.Result
 	processing sync.Mutex
 
 	metricsAddress  string
 	metricsPort     int
 	metricsEndpoint string
+	tlsCert         string
+	tlsKey          string
+	clientCAs       *x509.CertPool
+	authUser        string
+	authPass        string
 
+	self   *prometheus.Registry
 	logger logrus.StdLogger
 
 	stop chan time.Time
@@ -33,9 +52,20 @@ type Alien struct {
 // New is a constructor for an Alien and handles
 // the setup of maps/channels/mutex.
 func New() *Alien {
+	a, _ := NewWithOptions()
+	return a
+}
+
+// NewWithOptions is a constructor for an Alien which applies the
+// same defaults as New, then allows for variadic functional options
+// to be provided to further configure it.
+func NewWithOptions(options ...Option) (*Alien, error) {
 	a := &Alien{
-		init:            true,
-		probes:          make(map[*probe.Probe]bool),
+		init:   true,
+		probes: make(map[*probe.Probe]bool),
+		modules: map[string]Module{
+			DefaultModule: {Filter: probe.FilterResponseCode(200)},
+		},
 		results:         make(chan probe.Result),
 		processing:      sync.Mutex{},
 		metricsAddress:  "",
@@ -44,7 +74,16 @@ func New() *Alien {
 		logger:          log.New(os.Stdout, "Alien: ", 0),
 		stop:            make(chan time.Time),
 	}
-	return a
+
+	for _, o := range options {
+		if err := o(a); err != nil {
+			return nil, err
+		}
+	}
+
+	a.self = a.newSelfMetrics()
+
+	return a, nil
 }
 
 // AddProbe tells an Alien to manage the provided Probe
@@ -84,39 +123,124 @@ func (a *Alien) RemoveProbe(p *probe.Probe) error {
 	return nil
 }
 
-// Run is the event loop, which intentionally blocks until Stop is called
-func (a *Alien) Run() {
+// Run is the event loop, which intentionally blocks until Stop is called.
+//
+// Run returns an error if the metrics server cannot listen or stops
+// serving unexpectedly. All probes are stopped before Run returns.
+func (a *Alien) Run() error {
 	// Protect against uninitialised structs
 	if !a.init {
-		return
+		return ErrNotInitialised
 	}
+	defer a.stopProbes()
 
-	a.listenForTermination()
+	if a.clientCAs != nil && a.tlsCert == "" {
+		return ErrClientCANoTLS
+	}
 
-	a.logger.Printf("Starting metrics handler %s:%d%s...", a.metricsAddress, a.metricsPort, a.metricsEndpoint)
-	http.Handle(a.metricsEndpoint, promhttp.Handler())
-	srv := http.Server{
-		Addr:    fmt.Sprintf("%s:%d", a.metricsAddress, a.metricsPort),
-		Handler: nil,
+	addr := net.JoinHostPort(a.metricsAddress, strconv.Itoa(a.metricsPort))
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
 	}
-	go srv.ListenAndServe()
 
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: a.Handler(),
+	}
+	if a.clientCAs != nil {
+		srv.TLSConfig = &tls.Config{
+			ClientCAs:  a.clientCAs,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+		}
+	}
+
+	a.listenForTermination()
+
+	a.logger.Printf("Starting metrics handler %s%s...", addr, a.metricsEndpoint)
+	serving := make(chan error, 1)
+	go func() {
+		if a.tlsCert != "" {
+			serving <- srv.ServeTLS(l, a.tlsCert, a.tlsKey)
+			return
+		}
+		serving <- srv.Serve(l)
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	a.beat()
+
+loop:
 	for {
 		select {
+		case <-heartbeat.C:
+			a.beat()
+
 		case <-a.stop:
 			// Stop requested
 			a.logger.Println("Stop signal received, terminating...")
-
 			srv.Close()
+			break loop
 
-			a.processing.Lock()
-			for p := range a.probes {
-				p.Stop()
-			}
-			a.processing.Unlock()
-			return
+		case err = <-serving:
+			a.logger.Printf("Metrics handler failed: %v", err)
+			break loop
 		}
 	}
+	atomic.StoreInt64(&a.heartbeat, 0)
+	return err
+}
+
+// stopProbes stops every probe being managed
+func (a *Alien) stopProbes() {
+	a.processing.Lock()
+	defer a.processing.Unlock()
+
+	for p := range a.probes {
+		p.Stop()
+	}
+}
+
+// Handler returns the handler for the metrics and admin server,
+// with authentication applied if configured. The health endpoints
+// never require authentication so that orchestrators can reach them.
+func (a *Alien) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(a.metricsEndpoint, promhttp.HandlerFor(
+		prometheus.Gatherers{prometheus.DefaultGatherer, a.self},
+		promhttp.HandlerOpts{},
+	))
+	mux.HandleFunc(probesEndpoint, a.handleProbes)
+	mux.HandleFunc(probeEndpoint, a.handleProbe)
+
+	if a.authUser == "" {
+		mux.HandleFunc(healthEndpoint, a.handleHealth)
+		mux.HandleFunc(readyEndpoint, a.handleReady)
+		return mux
+	}
+
+	outer := http.NewServeMux()
+	outer.HandleFunc(healthEndpoint, a.handleHealth)
+	outer.HandleFunc(readyEndpoint, a.handleReady)
+	outer.Handle("/", a.basicAuth(mux))
+	return outer
+}
+
+// basicAuth wraps the handler so that requests must carry the
+// configured basic authentication credentials
+func (a *Alien) basicAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(a.authUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(a.authPass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="alien"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
 }
 
 // SetLogger sets the logger to use for all its probe logs
@@ -126,12 +250,12 @@ func (a *Alien) SetLogger(l logrus.StdLogger) {
 }
 
 // listenForTermination opens a new goroutine which
-// waits for an os.Kill or os.Interrupt and when received
+// waits for a SIGTERM or os.Interrupt and when received
 // sends a value on the stop channel, which gracefully exits
 func (a *Alien) listenForTermination() {
 	go func() {
-		ch := make(chan os.Signal)
-		signal.Notify(ch, os.Kill, os.Interrupt)
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGTERM, os.Interrupt)
 		<-ch
 		a.stop <- time.Now()
 	}()
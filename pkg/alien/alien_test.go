@@ -0,0 +1,99 @@
+package alien
+
+import (
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestBasicAuth(t *testing.T) {
+	a, err := NewWithOptions(WithBasicAuth("prom", "s3cret"), WithMetricsEndpoint("/custom"))
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	a.SetLogger(log.New(ioutil.Discard, "", 0))
+
+	var authSets = []struct {
+		user, pass string
+		path       string
+		status     int
+	}{
+		{user: "", pass: "", path: "/custom", status: http.StatusUnauthorized},
+		{user: "prom", pass: "wrong", path: "/custom", status: http.StatusUnauthorized},
+		{user: "prom", pass: "s3cret", path: "/custom", status: http.StatusOK},
+		{user: "prom", pass: "s3cret", path: "/metrics", status: http.StatusNotFound},
+		{user: "prom", pass: "s3cret", path: probesEndpoint, status: http.StatusOK},
+	}
+
+	h := a.Handler()
+	for _, as := range authSets {
+		r := httptest.NewRequest("GET", as.path, nil)
+		if as.user != "" {
+			r.SetBasicAuth(as.user, as.pass)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != as.status {
+			t.Errorf("%s as %q/%q: want status %d got %d", as.path, as.user, as.pass, as.status, rec.Code)
+		}
+	}
+}
+
+func TestRunBindError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	a, err := NewWithOptions(WithMetricsAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	a.SetLogger(log.New(ioutil.Discard, "", 0))
+
+	p, err := probe.New("http://127.0.0.1:0",
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	if err := a.AddProbe(p); err != nil {
+		t.Fatalf("AddProbe: %v", err)
+	}
+
+	if err := a.Run(); err == nil {
+		t.Fatal("want bind error, got nil")
+	}
+
+	// The probe's loop may take a moment to exit once stopped
+	for deadline := time.Now().Add(time.Second); p.Running() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if p.Running() {
+		t.Error("probe still running after Run returned")
+	}
+}
+
+func TestOptionsInvalid(t *testing.T) {
+	for _, o := range []Option{
+		WithMetricsAddress("", 70000),
+		WithMetricsEndpoint("metrics"),
+		WithMetricsEndpoint("/healthz"),
+		WithMetricsEndpoint("/probe"),
+		WithTLS("cert.pem", ""),
+		WithBasicAuth("", "pass"),
+		WithClientCA("/nonexistent/ca.pem"),
+	} {
+		if _, err := NewWithOptions(o); err == nil {
+			t.Errorf("want error from invalid option")
+		}
+	}
+}
@@ -12,4 +12,12 @@ func (e Error) Error() string {
 const (
 	ErrNotInitialised = Error("alien not initialised")
 	ErrProbeNotFound  = Error("probe not found")
+
+	ErrInvalidPort      = Error("alien invalid: metrics port")
+	ErrInvalidEndpoint  = Error("alien invalid: metrics endpoint must start with /")
+	ErrReservedEndpoint = Error("alien invalid: metrics endpoint is used by another handler")
+	ErrInvalidTLS       = Error("alien invalid: TLS needs a certificate and key")
+	ErrInvalidClientCA  = Error("alien invalid: no certificates in client CA file")
+	ErrInvalidBasicAuth = Error("alien invalid: basic auth needs a username")
+	ErrClientCANoTLS    = Error("alien invalid: client CA needs TLS")
 )
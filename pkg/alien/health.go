@@ -0,0 +1,120 @@
+package alien
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Health endpoint paths
+const (
+	healthEndpoint = "/healthz"
+	readyEndpoint  = "/readyz"
+)
+
+// Version is the version of Alien reported in alien_build_info,
+// set at build time with -ldflags "-X github.com/dangrier/alien/pkg/alien.Version=..."
+var Version = "dev"
+
+// heartbeatInterval is how often the event loop records that it
+// is alive
+const heartbeatInterval = time.Second
+
+// stallTimeout is how long the event loop may go without a
+// heartbeat before it is considered stalled
+const stallTimeout = 10 * heartbeatInterval
+
+// stallFactor is how many frequency periods a running probe may
+// go without completing a check before it is considered stalled
+const stallFactor = 3
+
+// newSelfMetrics creates the registry holding metrics about
+// Alien itself
+func (a *Alien) newSelfMetrics() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "alien_build_info",
+		Help: "Build information about Alien, always 1",
+	}, []string{
+		"version",
+		"goversion",
+	})
+	buildInfo.WithLabelValues(Version, runtime.Version()).Set(1)
+
+	configured := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "alien_probes_configured",
+		Help: "Number of probes being managed",
+	}, func() float64 {
+		a.processing.Lock()
+		defer a.processing.Unlock()
+		return float64(len(a.probes))
+	})
+
+	reg.MustRegister(buildInfo, configured)
+	return reg
+}
+
+// beat records that the event loop is alive
+func (a *Alien) beat() {
+	atomic.StoreInt64(&a.heartbeat, time.Now().UnixNano())
+}
+
+// handleHealth responds OK while the event loop and every
+// scheduled probe are making progress
+func (a *Alien) handleHealth(w http.ResponseWriter, r *http.Request) {
+	var problems []string
+
+	last := time.Unix(0, atomic.LoadInt64(&a.heartbeat))
+	if since := time.Since(last); since > stallTimeout {
+		problems = append(problems, fmt.Sprintf("event loop stalled for %s", since.Round(time.Second)))
+	}
+
+	for _, p := range a.Probes(nil) {
+		if !p.Running() {
+			continue
+		}
+		if since := time.Since(p.LastChecked()); since > stallFactor*p.Frequency() {
+			problems = append(problems, fmt.Sprintf("%s stalled for %s", p, since.Round(time.Second)))
+		}
+	}
+
+	respondHealth(w, problems)
+}
+
+// handleReady responds OK once Alien is running, every probe is
+// scheduled and every probe has completed its first check
+func (a *Alien) handleReady(w http.ResponseWriter, r *http.Request) {
+	var problems []string
+
+	if atomic.LoadInt64(&a.heartbeat) == 0 {
+		problems = append(problems, "not running")
+	}
+
+	for _, p := range a.Probes(nil) {
+		switch {
+		case !p.Running():
+			problems = append(problems, fmt.Sprintf("%s not scheduled", p))
+		case p.LastChecked().IsZero():
+			problems = append(problems, fmt.Sprintf("%s has not completed a check", p))
+		}
+	}
+
+	respondHealth(w, problems)
+}
+
+// respondHealth writes ok, or the problems with a 503 status
+func respondHealth(w http.ResponseWriter, problems []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(problems, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
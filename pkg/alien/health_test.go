@@ -0,0 +1,81 @@
+package alien
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestHealthAndReady(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	a, err := NewWithOptions(WithBasicAuth("prom", "s3cret"))
+	if err != nil {
+		t.Fatalf("NewWithOptions: %v", err)
+	}
+	a.SetLogger(log.New(ioutil.Discard, "", 0))
+	h := a.Handler()
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	// Not yet running
+	if code, body := get(readyEndpoint); code != http.StatusServiceUnavailable || !strings.Contains(body, "not running") {
+		t.Errorf("before Run: want not ready, got %d %s", code, body)
+	}
+
+	p, err := probe.New(target.URL,
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	if err := a.AddProbe(p); err != nil {
+		t.Fatalf("AddProbe: %v", err)
+	}
+	defer p.Stop()
+
+	// Running, with the probe scheduled and checked
+	a.beat()
+	if code, body := get(readyEndpoint); code != http.StatusOK {
+		t.Errorf("after first check: want ready, got %d %s", code, body)
+	}
+	if code, body := get(healthEndpoint); code != http.StatusOK {
+		t.Errorf("want healthy, got %d %s", code, body)
+	}
+
+	// Event loop stalled
+	atomic.StoreInt64(&a.heartbeat, time.Now().Add(-time.Minute).UnixNano())
+	if code, body := get(healthEndpoint); code != http.StatusServiceUnavailable || !strings.Contains(body, "stalled") {
+		t.Errorf("after stall: want unhealthy, got %d %s", code, body)
+	}
+}
+
+func TestSelfMetrics(t *testing.T) {
+	a := New()
+	a.SetLogger(log.New(ioutil.Discard, "", 0))
+
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, want := range []string{
+		`alien_build_info{goversion="`,
+		`alien_probes_configured 0`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("missing %q in metrics:\n%s", want, rec.Body)
+		}
+	}
+}
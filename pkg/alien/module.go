@@ -0,0 +1,151 @@
+package alien
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeEndpoint is the path of the blackbox_exporter style
+// multi-target endpoint
+const probeEndpoint = "/probe"
+
+// DefaultModule is the module used when a /probe request does not
+// name one, which expects a HTTP 200 response to a GET
+const DefaultModule = "http_200"
+
+// Module is a named set of probe settings used to run one-off
+// checks requested through the /probe endpoint
+type Module struct {
+	Method  string
+	Headers map[string]string
+	Payload string
+	Filter  probe.ResultFilter
+	Timeout time.Duration
+}
+
+// options converts the module to the equivalent probe options
+func (m Module) options() []probe.Option {
+	options := []probe.Option{
+		probe.WithSuccessFilter(m.Filter),
+	}
+	if m.Method != "" {
+		options = append(options, probe.WithMethod(m.Method))
+	}
+	if m.Payload != "" {
+		options = append(options, probe.WithPayload(m.Payload))
+	}
+	for k, v := range m.Headers {
+		options = append(options, probe.WithHeader(k, v))
+	}
+	return options
+}
+
+// AddModule makes a named module available to the /probe endpoint,
+// replacing any module with the same name
+func (a *Alien) AddModule(name string, m Module) error {
+	if !a.init {
+		return ErrNotInitialised
+	}
+
+	if m.Filter == nil {
+		return probe.ErrInvalidSuccessFilterEmpty
+	}
+
+	a.processing.Lock()
+	defer a.processing.Unlock()
+
+	a.modules[name] = m
+	return nil
+}
+
+// handleProbe runs a one-off check of the target using the named
+// module, and responds with the metrics for that check alone
+func (a *Alien) handleProbe(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	name := r.URL.Query().Get("module")
+	if name == "" {
+		name = DefaultModule
+	}
+
+	a.processing.Lock()
+	m, ok := a.modules[name]
+	a.processing.Unlock()
+	if !ok {
+		http.Error(w, "unknown module "+strconv.Quote(name), http.StatusBadRequest)
+		return
+	}
+
+	// The target comes from whoever made the request, so is never
+	// evaluated as a template
+	p, err := probe.New(target, append(m.options(), probe.WithLiteralEndpoint(), probe.WithLogger(a.logger))...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), scrapeTimeout(r, m.Timeout))
+	defer cancel()
+
+	res, err := p.Check(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if res.Error != nil {
+		a.logger.Printf("%s: failed: %v", p, res.Error)
+	}
+
+	success := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Whether the probe passed its success filter",
+	})
+	duration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "How long the probe took to complete in seconds",
+	})
+	code := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_http_status_code",
+		Help: "Response HTTP status code",
+	})
+
+	if res.Success {
+		success.Set(1)
+	}
+	duration.Set(res.Latency.Seconds())
+	code.Set(float64(res.Code))
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(success, duration, code)
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// scrapeTimeout returns the timeout for a check, using the shorter
+// of the module timeout and the timeout Prometheus says it will
+// wait for the scrape, less a little for the response itself
+func scrapeTimeout(r *http.Request, timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil {
+		scrape := time.Duration(seconds*float64(time.Second)) - 500*time.Millisecond
+		if scrape > 0 && scrape < timeout {
+			timeout = scrape
+		}
+	}
+
+	return timeout
+}
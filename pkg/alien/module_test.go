@@ -0,0 +1,96 @@
+package alien
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestHandleProbe(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Check") != "yes" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("healthy"))
+	}))
+	defer target.Close()
+
+	a := New()
+	a.SetLogger(log.New(ioutil.Discard, "", 0))
+	err := a.AddModule("healthy", Module{
+		Headers: map[string]string{"X-Check": "yes"},
+		Filter:  probe.FilterResponseContains("healthy"),
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("AddModule: %v", err)
+	}
+
+	var probeSets = []struct {
+		module string
+		status int
+		expect []string
+	}{
+		{module: "healthy", status: http.StatusOK, expect: []string{"probe_success 1", "probe_http_status_code 200"}},
+		{module: "", status: http.StatusOK, expect: []string{"probe_success 0", "probe_http_status_code 403"}},
+		{module: "missing", status: http.StatusBadRequest},
+	}
+
+	for _, ps := range probeSets {
+		q := url.Values{"target": {target.URL}, "module": {ps.module}}
+		rec := httptest.NewRecorder()
+		a.handleProbe(rec, httptest.NewRequest("GET", probeEndpoint+"?"+q.Encode(), nil))
+
+		if rec.Code != ps.status {
+			t.Errorf("module %q: want status %d got %d", ps.module, ps.status, rec.Code)
+		}
+		for _, want := range ps.expect {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("module %q: missing %q in:\n%s", ps.module, want, rec.Body)
+			}
+		}
+	}
+}
+
+func TestHandleProbeTemplate(t *testing.T) {
+	var paths []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer target.Close()
+
+	a := New()
+	a.SetLogger(log.New(ioutil.Discard, "", 0))
+
+	// A target is requested as given, never evaluated as a template
+	q := url.Values{"target": {target.URL + `/{{env "HOME"}}`}}
+	rec := httptest.NewRecorder()
+	a.handleProbe(rec, httptest.NewRequest("GET", probeEndpoint+"?"+q.Encode(), nil))
+
+	if len(paths) != 1 || paths[0] != `/{{env "HOME"}}` {
+		t.Errorf("want target requested as given, got %v (%d %s)", paths, rec.Code, rec.Body)
+	}
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	r := httptest.NewRequest("GET", probeEndpoint, nil)
+	if got := scrapeTimeout(r, 0); got != 10*time.Second {
+		t.Errorf("default timeout: want 10s got %s", got)
+	}
+
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "5")
+	if got := scrapeTimeout(r, 10*time.Second); got != 4500*time.Millisecond {
+		t.Errorf("scrape timeout: want 4.5s got %s", got)
+	}
+	if got := scrapeTimeout(r, time.Second); got != time.Second {
+		t.Errorf("module timeout: want 1s got %s", got)
+	}
+}
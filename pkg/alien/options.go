@@ -0,0 +1,88 @@
+package alien
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"strings"
+)
+
+// Option provides a way of configuring an Alien using
+// variadic parameters when calling alien.NewWithOptions()
+type Option func(*Alien) error
+
+// WithMetricsAddress sets the address and port the metrics and
+// admin server listens on. An empty address listens on all
+// interfaces.
+//
+// If not used, the default is port 8080 on all interfaces
+func WithMetricsAddress(address string, port int) Option {
+	return func(a *Alien) error {
+		if port < 0 || port > 65535 {
+			return ErrInvalidPort
+		}
+		a.metricsAddress = address
+		a.metricsPort = port
+		return nil
+	}
+}
+
+// WithMetricsEndpoint sets the path metrics are served on, which
+// cannot be one of the admin or health endpoints
+//
+// If not used, the default is /metrics
+func WithMetricsEndpoint(path string) Option {
+	return func(a *Alien) error {
+		if !strings.HasPrefix(path, "/") {
+			return ErrInvalidEndpoint
+		}
+		switch path {
+		case probesEndpoint, probeEndpoint, healthEndpoint, readyEndpoint:
+			return ErrReservedEndpoint
+		}
+		a.metricsEndpoint = path
+		return nil
+	}
+}
+
+// WithTLS serves metrics over HTTPS using the certificate and
+// key files, which are loaded when Run is called
+func WithTLS(certFile string, keyFile string) Option {
+	return func(a *Alien) error {
+		if certFile == "" || keyFile == "" {
+			return ErrInvalidTLS
+		}
+		a.tlsCert = certFile
+		a.tlsKey = keyFile
+		return nil
+	}
+}
+
+// WithClientCA requires clients of the metrics server to present
+// a certificate signed by a CA in the PEM file. Requires WithTLS.
+func WithClientCA(caFile string) Option {
+	return func(a *Alien) error {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrInvalidClientCA
+		}
+		a.clientCAs = pool
+		return nil
+	}
+}
+
+// WithBasicAuth requires clients of the metrics server to
+// authenticate with the username and password
+func WithBasicAuth(user string, pass string) Option {
+	return func(a *Alien) error {
+		if user == "" {
+			return ErrInvalidBasicAuth
+		}
+		a.authUser = user
+		a.authPass = pass
+		return nil
+	}
+}
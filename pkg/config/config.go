@@ -0,0 +1,359 @@
+package config
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dangrier/alien/pkg/alien"
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// Config is a set of probe definitions, usually loaded from a
+// JSON file with Load
+type Config struct {
+	Probes  []Probe           `json:"probes"`
+	Modules map[string]Module `json:"modules,omitempty"`
+}
+
+// Probe is the configuration of a single probe
+type Probe struct {
+	Type            string            `json:"type,omitempty"`
+	Endpoint        string            `json:"endpoint"`
+	Method          string            `json:"method,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Payload         string            `json:"payload,omitempty"`
+	PayloadHex      string            `json:"payload_hex,omitempty"`
+	TemplateSecrets bool              `json:"template_secrets,omitempty"`
+	Frequency       Duration          `json:"frequency,omitempty"`
+	Timeout         Duration          `json:"timeout,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Success         *Filter           `json:"success,omitempty"`
+	Steps           []Step            `json:"steps,omitempty"`
+	TLS             *TLS              `json:"tls,omitempty"`
+	Transport       *Transport        `json:"transport,omitempty"`
+	Redirects       *Redirects        `json:"redirects,omitempty"`
+	OAuth2          *OAuth2           `json:"oauth2,omitempty"`
+	GRPC            *GRPC             `json:"grpc,omitempty"`
+	Ping            *Ping             `json:"ping,omitempty"`
+	Mail            *Mail             `json:"mail,omitempty"`
+	Exec            *Exec             `json:"exec,omitempty"`
+}
+
+// OAuth2 is the configuration of a probe's OAuth2 client credentials,
+// where the client secret is a request template, such as
+// {{secret "/run/secrets/client"}} if the probe sets template_secrets
+type OAuth2 struct {
+	TokenURL     string   `json:"token_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// Redirects is the configuration of a probe's redirect policy
+type Redirects struct {
+	Max      *int `json:"max,omitempty"`
+	SameHost bool `json:"same_host,omitempty"`
+}
+
+// Transport is the configuration of how a probe makes connections
+type Transport struct {
+	KeepAlive        *bool             `json:"keep_alive,omitempty"`
+	FreshConnections bool              `json:"fresh_connections,omitempty"`
+	HTTP2            *bool             `json:"http2,omitempty"`
+	IPVersion        int               `json:"ip_version,omitempty"`
+	SourceAddress    string            `json:"source_address,omitempty"`
+	DialTimeout      Duration          `json:"dial_timeout,omitempty"`
+	Proxy            string            `json:"proxy,omitempty"`
+	Resolver         string            `json:"resolver,omitempty"`
+	Hosts            map[string]string `json:"hosts,omitempty"`
+	EachAddress      bool              `json:"each_address,omitempty"`
+}
+
+// proxyEnvironment is the Transport proxy which takes the proxy
+// from the environment
+const proxyEnvironment = "environment"
+
+// TLS is the configuration of a probe's TLS settings
+type TLS struct {
+	CA                 string `json:"ca,omitempty"`
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+	MinVersion         string `json:"min_version,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// tlsVersions maps configuration TLS versions to their constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Step is the configuration of a single step of a probe, see probe.Step
+type Step struct {
+	Name    string            `json:"name,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload string            `json:"payload,omitempty"`
+	Success *Filter           `json:"success,omitempty"`
+	Extract map[string]string `json:"extract,omitempty"`
+}
+
+// Module is the configuration of a module for the /probe endpoint
+type Module struct {
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Payload string            `json:"payload,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"`
+	Success *Filter           `json:"success,omitempty"`
+}
+
+// Load reads the configuration from a file
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads the configuration from JSON, rejecting unknown fields
+func Parse(r io.Reader) (*Config, error) {
+	var c Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if len(c.Probes) == 0 && len(c.Modules) == 0 {
+		return nil, ErrNoProbes
+	}
+	return &c, nil
+}
+
+// NewProbes creates a probe for each probe configuration, adding
+// the extra options to every probe ahead of its own
+func (c *Config) NewProbes(extra ...probe.Option) ([]*probe.Probe, error) {
+	probes := make([]*probe.Probe, 0, len(c.Probes))
+	for _, pc := range c.Probes {
+		options, err := pc.Options()
+		if err != nil {
+			return nil, err
+		}
+		p, err := probe.New(pc.Endpoint, append(append([]probe.Option{}, extra...), options...)...)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, p)
+	}
+	return probes, nil
+}
+
+// AddModules makes every configured module available to the Alien
+func (c *Config) AddModules(a *alien.Alien) error {
+	for name, mc := range c.Modules {
+		m, err := mc.Module()
+		if err != nil {
+			return err
+		}
+		if err := a.AddModule(name, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Options converts the configuration to probe options. A probe
+// without a success filter uses the default for its type, which
+// for HTTP probes expects a HTTP 200 response.
+func (pc Probe) Options() ([]probe.Option, error) {
+	success, err := successFilter(pc.Success, pc.defaultFilter())
+	if err != nil {
+		return nil, err
+	}
+	typeOptions, err := pc.typeOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []probe.Option{
+		probe.WithSuccessFilter(success),
+		probe.WithLabels(pc.Labels),
+	}
+	options = append(options, typeOptions...)
+	if pc.Method != "" {
+		options = append(options, probe.WithMethod(pc.Method))
+	}
+	if pc.Payload != "" && pc.PayloadHex != "" {
+		return nil, ErrInvalidPayload
+	}
+	if pc.Payload != "" {
+		options = append(options, probe.WithPayload(pc.Payload))
+	}
+	if pc.PayloadHex != "" {
+		options = append(options, probe.WithHexPayload(pc.PayloadHex))
+	}
+	for k, v := range pc.Headers {
+		options = append(options, probe.WithHeader(k, v))
+	}
+	if pc.TemplateSecrets {
+		options = append(options, probe.WithTemplateSecrets())
+	}
+	if pc.Frequency != 0 {
+		options = append(options, probe.WithFrequency(time.Duration(pc.Frequency)))
+	}
+	if pc.Timeout != 0 {
+		options = append(options, probe.WithClient(time.Duration(pc.Timeout)))
+	}
+	if pc.TLS != nil {
+		tlsOptions, err := pc.TLS.Options()
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, tlsOptions...)
+	}
+	if pc.Transport != nil {
+		options = append(options, pc.Transport.Options()...)
+	}
+	if pc.Redirects != nil {
+		if pc.Redirects.Max != nil {
+			options = append(options, probe.WithRedirectLimit(*pc.Redirects.Max))
+		}
+		if pc.Redirects.SameHost {
+			options = append(options, probe.WithRedirectSameHost())
+		}
+	}
+	if pc.OAuth2 != nil {
+		options = append(options, probe.WithOAuth2ClientCredentials(pc.OAuth2.TokenURL, pc.OAuth2.ClientID, pc.OAuth2.ClientSecret, pc.OAuth2.Scopes...))
+	}
+	if len(pc.Steps) > 0 {
+		steps := make([]probe.Step, len(pc.Steps))
+		for i, sc := range pc.Steps {
+			if steps[i], err = sc.Step(); err != nil {
+				return nil, err
+			}
+		}
+		options = append(options, probe.WithSteps(steps...))
+	}
+	return options, nil
+}
+
+// Options converts the TLS configuration to probe options
+func (tc TLS) Options() ([]probe.Option, error) {
+	var options []probe.Option
+	if tc.CA != "" {
+		options = append(options, probe.WithTLSCA(tc.CA))
+	}
+	if tc.Cert != "" || tc.Key != "" {
+		options = append(options, probe.WithTLSClientCert(tc.Cert, tc.Key))
+	}
+	if tc.ServerName != "" {
+		options = append(options, probe.WithTLSServerName(tc.ServerName))
+	}
+	if tc.MinVersion != "" {
+		v, ok := tlsVersions[tc.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("%v: %q", ErrInvalidTLSVersion, tc.MinVersion)
+		}
+		options = append(options, probe.WithTLSMinVersion(v))
+	}
+	if tc.InsecureSkipVerify {
+		options = append(options, probe.WithTLSInsecureSkipVerify())
+	}
+	return options, nil
+}
+
+// Options converts the transport configuration to probe options
+func (tc Transport) Options() []probe.Option {
+	var options []probe.Option
+	if tc.KeepAlive != nil {
+		options = append(options, probe.WithKeepAlive(*tc.KeepAlive))
+	}
+	if tc.FreshConnections {
+		options = append(options, probe.WithFreshConnections())
+	}
+	if tc.HTTP2 != nil {
+		options = append(options, probe.WithHTTP2(*tc.HTTP2))
+	}
+	if tc.IPVersion != 0 {
+		options = append(options, probe.WithIPVersion(tc.IPVersion))
+	}
+	if tc.SourceAddress != "" {
+		options = append(options, probe.WithSourceAddress(tc.SourceAddress))
+	}
+	if tc.DialTimeout != 0 {
+		options = append(options, probe.WithDialTimeout(time.Duration(tc.DialTimeout)))
+	}
+	if tc.Resolver != "" {
+		options = append(options, probe.WithResolver(tc.Resolver))
+	}
+	for host, ip := range tc.Hosts {
+		options = append(options, probe.WithHostOverride(host, ip))
+	}
+	if tc.EachAddress {
+		options = append(options, probe.WithEachAddress())
+	}
+	switch tc.Proxy {
+	case "":
+	case proxyEnvironment:
+		options = append(options, probe.WithProxyFromEnvironment())
+	default:
+		options = append(options, probe.WithProxy(tc.Proxy))
+	}
+	return options
+}
+
+// Step converts the configuration to a probe.Step. A step without
+// a success filter accepts any response.
+func (sc Step) Step() (probe.Step, error) {
+	step := probe.Step{
+		Name:    sc.Name,
+		Method:  sc.Method,
+		URL:     sc.URL,
+		Headers: sc.Headers,
+		Payload: sc.Payload,
+		Extract: sc.Extract,
+	}
+	if sc.Success != nil {
+		f, err := sc.Success.ResultFilter()
+		if err != nil {
+			return probe.Step{}, err
+		}
+		step.Filter = f
+	}
+	return step, nil
+}
+
+// Module converts the configuration to an alien.Module. A module
+// without a success filter expects a HTTP 200 response.
+func (mc Module) Module() (alien.Module, error) {
+	success, err := successFilter(mc.Success, probe.FilterResponseCode(200))
+	if err != nil {
+		return alien.Module{}, err
+	}
+
+	return alien.Module{
+		Method:  mc.Method,
+		Headers: mc.Headers,
+		Payload: mc.Payload,
+		Filter:  success,
+		Timeout: time.Duration(mc.Timeout),
+	}, nil
+}
+
+// successFilter converts an optional filter configuration,
+// defaulting to the given filter
+func successFilter(f *Filter, def probe.ResultFilter) (probe.ResultFilter, error) {
+	if f == nil {
+		return def, nil
+	}
+	return f.ResultFilter()
+}
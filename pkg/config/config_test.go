@@ -0,0 +1,139 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/config"
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+const testConfig = `{
+	"probes": [
+		{
+			"endpoint": "http://example.invalid/health",
+			"frequency": "30s",
+			"labels": {"team": "web"},
+			"success": {"all": [{"code": 200}, {"not": {"contains": "degraded"}}]}
+		},
+		{
+			"endpoint": "http://example.invalid/login",
+			"method": "POST",
+			"payload": "{}"
+		}
+	],
+	"modules": {
+		"http_post": {"method": "POST", "timeout": "5s", "success": {"any": [{"code": 200}, {"code": 204}]}}
+	}
+}`
+
+func TestParse(t *testing.T) {
+	c, err := config.Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(c.Probes) != 2 || time.Duration(c.Probes[0].Frequency) != 30*time.Second {
+		t.Fatalf("unexpected probes: %+v", c.Probes)
+	}
+
+	success, err := c.Probes[0].Success.ResultFilter()
+	if err != nil {
+		t.Fatalf("ResultFilter: %v", err)
+	}
+	if !success.Check(&probe.Result{Code: 200, Body: "fine", Headers: http.Header{}}) {
+		t.Errorf("filter %v rejected a healthy result", success)
+	}
+	if success.Check(&probe.Result{Code: 200, Body: "degraded"}) {
+		t.Errorf("filter %v accepted a degraded result", success)
+	}
+
+	m, err := c.Modules["http_post"].Module()
+	if err != nil {
+		t.Fatalf("Module: %v", err)
+	}
+	if m.Method != "POST" || m.Timeout != 5*time.Second || !m.Filter.Check(&probe.Result{Code: 204}) {
+		t.Errorf("unexpected module: %+v", m)
+	}
+}
+
+var invalidConfigs = []string{
+	`{}`,
+	`{"probes": [{"endpoint": "http://example.invalid", "frequency": "often"}]}`,
+	`{"probes": [{"endpoint": "http://example.invalid"}]`,
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, ic := range invalidConfigs {
+		if _, err := config.Parse(strings.NewReader(ic)); err == nil {
+			t.Errorf("want error parsing %s", ic)
+		}
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	code := 200
+	contains := "ok"
+	for _, f := range []config.Filter{
+		{},
+		{Code: &code, Contains: &contains},
+		{All: []config.Filter{{}}},
+		{All: []config.Filter{}},
+	} {
+		if _, err := f.ResultFilter(); err == nil {
+			t.Errorf("want error converting %+v", f)
+		}
+	}
+}
+
+func TestProbeTypes(t *testing.T) {
+	var typeSets = []struct {
+		config string
+		kind   string
+	}{
+		{config: `{"endpoint": "http://example.invalid"}`, kind: "GET"},
+		{config: `{"type": "grpc", "endpoint": "http://example.invalid:50051", "grpc": {"service": "api"}}`, kind: "GRPC"},
+		{config: `{"type": "websocket", "endpoint": "wss://example.invalid/live", "payload": "ping"}`, kind: "WS"},
+		{config: `{"type": "ping", "endpoint": "example.invalid", "ping": {"count": 5, "interval": "200ms"}}`, kind: "PING"},
+		{config: `{"type": "udp", "endpoint": "udp://example.invalid:514", "payload_hex": "de ad be ef"}`, kind: "UDP"},
+		{config: `{"type": "smtp", "endpoint": "smtp://mail.example.invalid", "mail": {"hello": "alien.example.invalid", "starttls": true}}`, kind: "SMTP"},
+		{config: `{"type": "imap", "endpoint": "imaps://mail.example.invalid"}`, kind: "IMAP"},
+		{config: `{"type": "pop3", "endpoint": "pop3://mail.example.invalid", "mail": {"starttls": true}}`, kind: "POP3"},
+		{config: `{"type": "postgres", "endpoint": "postgres://alien:{{env \"PGPASSWORD\"}}@db.example.invalid/app", "template_secrets": true, "payload": "SELECT 1"}`, kind: "POSTGRES"},
+		{config: `{"type": "mysql", "endpoint": "mysql://alien@db.example.invalid/app?tls=true"}`, kind: "MYSQL"},
+		{config: `{"type": "redis", "endpoint": "redis://cache.example.invalid/1", "payload": "GET lag", "success": {"max_value": 5}}`, kind: "REDIS"},
+		{config: `{"type": "exec", "endpoint": "/usr/lib/nagios/plugins/check_disk", "exec": {"args": ["-w", "20%"], "env": {"LANG": "C"}}}`, kind: "EXEC"},
+	}
+
+	for _, ts := range typeSets {
+		c, err := config.Parse(strings.NewReader(`{"probes": [` + ts.config + `]}`))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", ts.config, err)
+		}
+		probes, err := c.NewProbes(probe.WithLogger(log.New(ioutil.Discard, "", 0)))
+		if err != nil {
+			t.Fatalf("%s: NewProbes: %v", ts.config, err)
+		}
+		if !strings.HasPrefix(probes[0].String(), "Probe<"+ts.kind+" ") {
+			t.Errorf("%s: want %s probe, got %s", ts.config, ts.kind, probes[0])
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"type": "carrier-pigeon", "endpoint": "loft"}`,
+		`{"type": "ping", "endpoint": "example.invalid", "transport": {"each_address": true}}`,
+		`{"type": "exec", "endpoint": "/bin/true", "transport": {"each_address": true}}`,
+	} {
+		c, err := config.Parse(strings.NewReader(`{"probes": [` + invalid + `]}`))
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", invalid, err)
+		}
+		if _, err := c.NewProbes(); err == nil {
+			t.Errorf("%s: want error", invalid)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package config
+
+// Error is a string which satisfies the error interface
+type Error string
+
+// Error implements the error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Define error constants
+const (
+	ErrInvalidDuration    = Error("config invalid: duration")
+	ErrInvalidFilterAll   = Error("config invalid: filter all must have at least one member")
+	ErrInvalidFilter      = Error("config invalid: filter must have exactly one of code, contains, final_url, redirects, health_status, max_value, capability, max_packet_loss, max_rtt, all, any or not")
+	ErrInvalidTLSVersion  = Error("config invalid: TLS version must be 1.0, 1.1, 1.2 or 1.3")
+	ErrNoProbes           = Error("config invalid: no probes")
+	ErrInvalidPayload     = Error("config invalid: only one of payload and payload_hex may be set")
+	ErrInvalidType        = Error("config invalid: probe type")
+	ErrInvalidEachAddress = Error("config invalid: each_address is not supported by ping and exec probes")
+)
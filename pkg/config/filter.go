@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// Filter is the configuration form of a probe.ResultFilter, where
+// exactly one field is set, for example:
+//
+//	{"all": [{"code": 200}, {"contains": "ok"}]}
+type Filter struct {
+	Code          *int      `json:"code,omitempty"`
+	Contains      *string   `json:"contains,omitempty"`
+	FinalURL      *string   `json:"final_url,omitempty"`
+	Redirects     *int      `json:"redirects,omitempty"`
+	HealthStatus  *string   `json:"health_status,omitempty"`
+	Capability    *string   `json:"capability,omitempty"`
+	MaxValue      *float64  `json:"max_value,omitempty"`
+	MaxPacketLoss *float64  `json:"max_packet_loss,omitempty"`
+	MaxRTT        *Duration `json:"max_rtt,omitempty"`
+	All           []Filter  `json:"all,omitempty"`
+	Any           []Filter  `json:"any,omitempty"`
+	Not           *Filter   `json:"not,omitempty"`
+}
+
+// ResultFilter converts the configuration to a probe.ResultFilter
+func (f Filter) ResultFilter() (probe.ResultFilter, error) {
+	if !wellFormed(f) {
+		return nil, ErrInvalidFilter
+	}
+
+	switch {
+	case f.Code != nil:
+		return probe.FilterResponseCode(*f.Code), nil
+	case f.Contains != nil:
+		return probe.FilterResponseContains(*f.Contains), nil
+	case f.FinalURL != nil:
+		return probe.FilterFinalURL(*f.FinalURL), nil
+	case f.Redirects != nil:
+		return probe.FilterRedirectCount(*f.Redirects), nil
+	case f.HealthStatus != nil:
+		return probe.FilterHealthStatus(*f.HealthStatus), nil
+	case f.MaxValue != nil:
+		return probe.FilterMaxValue(*f.MaxValue), nil
+	case f.Capability != nil:
+		return probe.FilterCapability(*f.Capability), nil
+	case f.MaxPacketLoss != nil:
+		return probe.FilterMaxPacketLoss(*f.MaxPacketLoss), nil
+	case f.MaxRTT != nil:
+		return probe.FilterMaxRTT(*f.MaxRTT), nil
+	case f.All != nil:
+		// An empty all would match every result, so the probe could
+		// never fail
+		if len(f.All) == 0 {
+			return nil, ErrInvalidFilterAll
+		}
+		members, err := resultFilters(f.All)
+		return probe.FilterGroupAll{Members: members}, err
+	case f.Any != nil:
+		members, err := resultFilters(f.Any)
+		return probe.FilterGroupAny{Members: members}, err
+	default:
+		member, err := f.Not.ResultFilter()
+		return probe.FilterGroupNot{Member: member}, err
+	}
+}
+
+// resultFilters converts each filter configuration in turn
+func resultFilters(filters []Filter) ([]probe.ResultFilter, error) {
+	members := make([]probe.ResultFilter, len(filters))
+	for i, f := range filters {
+		rf, err := f.ResultFilter()
+		if err != nil {
+			return nil, err
+		}
+		members[i] = rf
+	}
+	return members, nil
+}
+
+// wellFormed reports whether exactly one field of the filter is set,
+// without checking any members
+func wellFormed(f Filter) bool {
+	set := 0
+	for _, ok := range []bool{
+		f.Code != nil, f.Contains != nil, f.FinalURL != nil, f.Redirects != nil, f.HealthStatus != nil,
+		f.MaxValue != nil, f.Capability != nil, f.MaxPacketLoss != nil, f.MaxRTT != nil,
+		f.All != nil, f.Any != nil, f.Not != nil,
+	} {
+		if ok {
+			set++
+		}
+	}
+	return set == 1
+}
+
+// ParseFilter reads a single filter from its JSON configuration
+// form and converts it to a probe.ResultFilter
+func ParseFilter(s string) (probe.ResultFilter, error) {
+	var f Filter
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	return f.ResultFilter()
+}
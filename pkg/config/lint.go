@@ -0,0 +1,313 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// DefaultMinFrequency is the lowest probe frequency a Linter
+// accepts unless told otherwise
+const DefaultMinFrequency = time.Second
+
+// Issue is a problem found in a configuration file
+type Issue struct {
+	Position Position
+	Message  string
+}
+
+// String implements the Stringer interface
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s", i.Position, i.Message)
+}
+
+// Linter checks a configuration for problems, including those
+// which would not stop it from loading
+type Linter struct {
+	MinFrequency time.Duration
+}
+
+// NewLinter is a Linter constructor which applies the defaults
+func NewLinter() *Linter {
+	return &Linter{
+		MinFrequency: DefaultMinFrequency,
+	}
+}
+
+// lint holds the state while linting a single file
+type lint struct {
+	*Linter
+	file   string
+	data   []byte
+	issues []Issue
+}
+
+// LintFile reads and lints a configuration file. The error is
+// only set when the file cannot be read.
+func (l *Linter) LintFile(path string) ([]Issue, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return l.Lint(path, data), nil
+}
+
+// Lint checks the configuration, with file used to name the
+// source in issue positions, and returns every issue found in
+// the order they appear in the file
+func (l *Linter) Lint(file string, data []byte) []Issue {
+	s := &lint{Linter: l, file: file, data: data}
+
+	root, dupes, err := parseNodes(data)
+	if err != nil {
+		var off int64
+		if se, ok := err.(*json.SyntaxError); ok {
+			off = se.Offset
+		}
+		s.add(off, "syntax error: %v", err)
+		return s.issues
+	}
+
+	for _, d := range dupes {
+		s.add(d.key, "duplicate field")
+	}
+	s.fields(root, reflect.TypeOf(Config{}))
+
+	if root.fields == nil {
+		s.add(root.start, "configuration must be an object")
+		return s.sorted()
+	}
+
+	probes := root.field("probes")
+	modules := root.field("modules")
+	if (probes == nil || len(probes.items) == 0) && (modules == nil || len(modules.fields) == 0) {
+		s.add(root.start, "%v", ErrNoProbes)
+	}
+
+	if probes != nil {
+		seen := make(map[string]*node)
+		for _, n := range probes.items {
+			var pc Probe
+			if !s.decode(n, &pc) {
+				continue
+			}
+			s.probe(n, pc)
+
+			// HTTP probes are told apart by method, and others by type
+			key := strings.ToUpper(pc.Type) + " " + pc.Endpoint
+			if pc.Type == "" || pc.Type == TypeHTTP {
+				method := pc.Method
+				if method == "" {
+					method = "GET"
+				}
+				key = strings.ToUpper(method) + " " + pc.Endpoint
+			}
+			if first, ok := seen[key]; ok {
+				s.add(n.start, "duplicate endpoint %s, first defined at %s", key, position(file, data, first.start))
+				continue
+			}
+			seen[key] = n
+		}
+	}
+
+	if modules != nil {
+		for _, name := range modules.keys {
+			n := modules.fields[name]
+			var mc Module
+			if !s.decode(n, &mc) {
+				continue
+			}
+			if mc.Success != nil {
+				s.filter(n.field("success"), *mc.Success)
+			}
+			if _, err := mc.Module(); err != nil {
+				s.add(n.start, "module %q: %v", name, err)
+			}
+		}
+	}
+
+	return s.sorted()
+}
+
+// add records an issue at the offset
+func (s *lint) add(off int64, format string, args ...interface{}) {
+	s.issues = append(s.issues, Issue{
+		Position: position(s.file, s.data, off),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// sorted returns the issues in file order
+func (s *lint) sorted() []Issue {
+	sort.SliceStable(s.issues, func(i, j int) bool {
+		a, b := s.issues[i].Position, s.issues[j].Position
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return s.issues
+}
+
+// decode unmarshals the node, recording an issue on failure
+func (s *lint) decode(n *node, v interface{}) bool {
+	if err := json.Unmarshal(s.data[n.start:n.end], v); err != nil {
+		s.add(n.start, "%v", err)
+		return false
+	}
+	return true
+}
+
+// fields reports object keys which do not match a field of the type
+func (s *lint) fields(n *node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.fields == nil {
+			return
+		}
+		// Keys match fields regardless of case, as with encoding/json
+		known := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				known[strings.ToLower(name)] = f.Type
+			}
+		}
+		for _, k := range n.keys {
+			ft, ok := known[strings.ToLower(k)]
+			if !ok {
+				s.add(n.fields[k].key, "unknown field %q", k)
+				continue
+			}
+			s.fields(n.fields[k], ft)
+		}
+	case reflect.Slice:
+		for _, item := range n.items {
+			s.fields(item, t.Elem())
+		}
+	case reflect.Map:
+		for _, child := range n.fields {
+			s.fields(child, t.Elem())
+		}
+	}
+}
+
+// probe checks a single probe configuration
+func (s *lint) probe(n *node, pc Probe) {
+	if pc.Success != nil {
+		s.filter(n.field("success"), *pc.Success)
+	}
+
+	if pc.Frequency != 0 && time.Duration(pc.Frequency) < s.MinFrequency {
+		s.add(n.field("frequency").start, "frequency %s is below the minimum of %s", time.Duration(pc.Frequency), s.MinFrequency)
+	}
+
+	options, err := pc.Options()
+	if err != nil {
+		// Filter problems are reported against the filter itself
+		return
+	}
+	options = append([]probe.Option{probe.WithLogger(log.New(ioutil.Discard, "", 0))}, options...)
+	p, err := probe.New(pc.Endpoint, options...)
+	if err != nil {
+		s.add(n.start, "%v", err)
+		return
+	}
+	if err := p.Validate(); err != nil {
+		s.add(n.start, "%v", err)
+	}
+}
+
+// filter checks a filter configuration and its members for
+// filters which are malformed or which can never match
+func (s *lint) filter(n *node, f Filter) filterOutcome {
+	if _, err := f.ResultFilter(); err != nil && !wellFormed(f) {
+		s.add(n.start, "%v", err)
+		return filterOutcome{}
+	}
+
+	switch {
+	case f.Code != nil, f.FinalURL != nil, f.Redirects != nil, f.HealthStatus != nil,
+		f.MaxValue != nil, f.Capability != nil, f.MaxPacketLoss != nil, f.MaxRTT != nil:
+		return filterOutcome{}
+	case f.Contains != nil:
+		return filterOutcome{always: *f.Contains == ""}
+	case f.All != nil:
+		if len(f.All) == 0 {
+			s.add(n.start, "%v", ErrInvalidFilterAll)
+			return filterOutcome{}
+		}
+		out := filterOutcome{always: true}
+		codes := make(map[int]bool)
+		notCodes := make(map[int]bool)
+		for i, m := range f.All {
+			mo := s.filter(n.field("all").items[i], m)
+			out.never = out.never || mo.never
+			out.always = out.always && mo.always
+			if m.Code != nil {
+				codes[*m.Code] = true
+			}
+			if m.Not != nil && m.Not.Code != nil {
+				notCodes[*m.Not.Code] = true
+			}
+		}
+		if len(codes) > 1 {
+			s.add(n.start, "filter can never match: all requires different response codes %v", sortedCodes(codes))
+			out.never = true
+		}
+		for c := range codes {
+			if notCodes[c] {
+				s.add(n.start, "filter can never match: all requires response code %d and not %d", c, c)
+				out.never = true
+			}
+		}
+		return out
+	case f.Any != nil:
+		out := filterOutcome{never: true}
+		for i, m := range f.Any {
+			mo := s.filter(n.field("any").items[i], m)
+			out.never = out.never && mo.never
+			out.always = out.always || mo.always
+		}
+		if len(f.Any) == 0 {
+			s.add(n.start, "filter can never match: any has no members")
+		}
+		return out
+	case f.Not != nil:
+		if f.Not.Not != nil {
+			s.add(n.start, "redundant filter: not directly nests another not")
+		}
+		mo := s.filter(n.field("not"), *f.Not)
+		if mo.always {
+			s.add(n.start, "filter can never match: not wraps a filter which always matches")
+		}
+		return filterOutcome{never: mo.always, always: mo.never}
+	}
+	return filterOutcome{}
+}
+
+// filterOutcome records whether a filter can be shown to never,
+// or always, match regardless of the response
+type filterOutcome struct {
+	never  bool
+	always bool
+}
+
+// sortedCodes returns the response codes in order
+func sortedCodes(codes map[int]bool) []int {
+	var sorted []int
+	for c := range codes {
+		sorted = append(sorted, c)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
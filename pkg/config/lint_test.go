@@ -0,0 +1,74 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/config"
+)
+
+const lintConfig = `{
+  "probes": [
+    {"endpoint": "http://a", "frequency": "100ms", "sucess": {"code": 200}},
+    {"endpoint": "http://a", "success": {"all": [{"code": 200}, {"code": 404}]}},
+    {"endpoint": "http://b", "success": {"not": {"not": {"contains": ""}}}},
+    {"endpoint": "", "method": "HEAD"},
+    {"endpoint": "http://c", "success": {"any": [{"code": 200, "contains": "x"}]}},
+    {"endpoint": "http://d", "frequency": "soon"},
+    {"endpoint": "http://e", "success": {"any": []}},
+    {"endpoint": "http://f", "success": {"all": []}},
+    {"endpoint": "http://g", "Frequency": "1ms", "Success": {"All": [{"code": 200}, {"code": 500}]}},
+    {"type": "websocket", "endpoint": "http://a"},
+    {"type": "ping", "endpoint": "h"},
+    {"type": "ping", "endpoint": "h"}
+  ],
+  "modules": {
+    "m": {"success": {"all": [{"code": 200}, {"not": {"code": 200}}]}},
+    "n": {"Success": {"Not": {"contains": ""}}}
+  }
+}`
+
+var lintExpect = []string{
+	`lint.json:3:43: frequency 100ms is below the minimum of 1s`,
+	`lint.json:3:52: unknown field "sucess"`,
+	`lint.json:4:5: duplicate endpoint GET http://a, first defined at lint.json:3:5`,
+	`lint.json:4:41: filter can never match: all requires different response codes [200 404]`,
+	`lint.json:5:41: redundant filter: not directly nests another not`,
+	`lint.json:5:49: filter can never match: not wraps a filter which always matches`,
+	`lint.json:6:5: probe invalid: endpoint`,
+	`lint.json:7:50: config invalid: filter must have exactly one of code, contains, final_url, redirects, health_status, max_value, capability, max_packet_loss, max_rtt, all, any or not`,
+	`lint.json:8:5: config invalid: duration: "soon"`,
+	`lint.json:9:41: filter can never match: any has no members`,
+	`lint.json:10:41: config invalid: filter all must have at least one member`,
+	`lint.json:11:43: frequency 1ms is below the minimum of 1s`,
+	`lint.json:11:61: filter can never match: all requires different response codes [200 500]`,
+	`lint.json:14:5: duplicate endpoint PING h, first defined at lint.json:13:5`,
+	`lint.json:17:22: filter can never match: all requires response code 200 and not 200`,
+	`lint.json:18:22: filter can never match: not wraps a filter which always matches`,
+}
+
+func TestLint(t *testing.T) {
+	issues := config.NewLinter().Lint("lint.json", []byte(lintConfig))
+
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+
+	if strings.Join(got, "\n") != strings.Join(lintExpect, "\n") {
+		t.Errorf("want issues:\n%s\ngot:\n%s", strings.Join(lintExpect, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	if issues := config.NewLinter().Lint("test.json", []byte(testConfig)); len(issues) > 0 {
+		t.Errorf("want no issues, got %v", issues)
+	}
+}
+
+func TestLintSyntax(t *testing.T) {
+	issues := config.NewLinter().Lint("bad.json", []byte("{\n  \"probes\": [\n    {\"endpoint\": }\n  ]\n}"))
+	if len(issues) != 1 || issues[0].Position.Line != 3 || !strings.Contains(issues[0].Message, "syntax error") {
+		t.Errorf("want one syntax error on line 3, got %v", issues)
+	}
+}
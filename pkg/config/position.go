@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Position is a location in a configuration file
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String implements the Stringer interface
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// node is a JSON value along with where it was found, so that
+// problems can be reported against a position in the file
+type node struct {
+	start int64
+	end   int64
+	key   int64 // start of the object key naming this value, if any
+
+	keys   []string
+	fields map[string]*node
+	items  []*node
+}
+
+// parseNodes reads a JSON document into a tree of nodes, returning
+// any fields which appear more than once in an object
+func parseNodes(data []byte) (*node, []*node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var dupes []*node
+	root, err := parseNode(dec, data, &dupes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, &json.SyntaxError{Offset: dec.InputOffset()}
+	}
+	return root, dupes, nil
+}
+
+// parseNode reads the next value from the decoder
+func parseNode(dec *json.Decoder, data []byte, dupes *[]*node) (*node, error) {
+	n := &node{start: skipSeparators(data, dec.InputOffset())}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		n.fields = make(map[string]*node)
+		for dec.More() {
+			key := skipSeparators(data, dec.InputOffset())
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name := t.(string)
+			child, err := parseNode(dec, data, dupes)
+			if err != nil {
+				return nil, err
+			}
+			child.key = key
+			if n.field(name) != nil {
+				*dupes = append(*dupes, child)
+			}
+			n.keys = append(n.keys, name)
+			n.fields[name] = child
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	case json.Delim('['):
+		for dec.More() {
+			child, err := parseNode(dec, data, dupes)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, child)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	n.end = dec.InputOffset()
+	return n, nil
+}
+
+// field returns the value of the object field with the name, which
+// like encoding/json matches keys regardless of case, and is the
+// last such field when there are several
+func (n *node) field(name string) *node {
+	var found *node
+	for _, k := range n.keys {
+		if strings.EqualFold(k, name) {
+			found = n.fields[k]
+		}
+	}
+	return found
+}
+
+// skipSeparators returns the offset of the first byte at or after
+// off which is not whitespace or a JSON separator
+func skipSeparators(data []byte, off int64) int64 {
+	for off < int64(len(data)) {
+		switch data[off] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			off++
+		default:
+			return off
+		}
+	}
+	return off
+}
+
+// position converts a byte offset to a line and column
+func position(file string, data []byte, off int64) Position {
+	if off > int64(len(data)) {
+		off = int64(len(data))
+	}
+	before := data[:off]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(off) - bytes.LastIndexByte(before, '\n')
+	return Position{File: file, Line: line, Column: col}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// Probe types, given as the type of a probe configuration. A probe
+// without a type is a HTTP probe.
+const (
+	TypeHTTP      = "http"
+	TypeGRPC      = "grpc"
+	TypeWebSocket = "websocket"
+	TypePing      = "ping"
+	TypeUDP       = "udp"
+	TypeSMTP      = "smtp"
+	TypeIMAP      = "imap"
+	TypePOP3      = "pop3"
+	TypePostgres  = "postgres"
+	TypeMySQL     = "mysql"
+	TypeRedis     = "redis"
+	TypeExec      = "exec"
+)
+
+// GRPC is the configuration of a gRPC health check probe, where an
+// empty service checks the server as a whole
+type GRPC struct {
+	Service string `json:"service,omitempty"`
+}
+
+// Ping is the configuration of an ICMP ping probe, where the endpoint
+// is a host name or IP address
+type Ping struct {
+	Count    int      `json:"count,omitempty"`
+	Interval Duration `json:"interval,omitempty"`
+}
+
+// Mail is the configuration of a SMTP, IMAP or POP3 probe, where
+// the hello name is only sent by SMTP probes
+type Mail struct {
+	Hello    string `json:"hello,omitempty"`
+	StartTLS bool   `json:"starttls,omitempty"`
+}
+
+// Exec is the configuration of a probe which runs the command named
+// by its endpoint, where argument and environment values may be
+// templates
+type Exec struct {
+	Args []string          `json:"args,omitempty"`
+	Env  map[string]string `json:"env,omitempty"`
+}
+
+// defaultPing is the configuration of a ping probe without one, or
+// for the fields it leaves unset
+var defaultPing = Ping{Count: 3, Interval: Duration(time.Second)}
+
+// typeOptions returns the options which make a probe of its type
+func (pc Probe) typeOptions() ([]probe.Option, error) {
+	if (pc.Type == TypePing || pc.Type == TypeExec) && pc.Transport != nil && pc.Transport.EachAddress {
+		return nil, ErrInvalidEachAddress
+	}
+	switch pc.Type {
+	case "", TypeHTTP:
+		return nil, nil
+	case TypeGRPC:
+		var gc GRPC
+		if pc.GRPC != nil {
+			gc = *pc.GRPC
+		}
+		return []probe.Option{probe.WithGRPCHealth(gc.Service)}, nil
+	case TypeWebSocket:
+		return []probe.Option{probe.WithWebSocket()}, nil
+	case TypePing:
+		ping := defaultPing
+		if pc.Ping != nil {
+			if pc.Ping.Count != 0 {
+				ping.Count = pc.Ping.Count
+			}
+			if pc.Ping.Interval != 0 {
+				ping.Interval = pc.Ping.Interval
+			}
+		}
+		return []probe.Option{probe.WithPing(ping.Count, time.Duration(ping.Interval))}, nil
+	case TypeUDP:
+		return []probe.Option{probe.WithUDP()}, nil
+	case TypeSMTP, TypeIMAP, TypePOP3:
+		var mc Mail
+		if pc.Mail != nil {
+			mc = *pc.Mail
+		}
+		var options []probe.Option
+		switch pc.Type {
+		case TypeSMTP:
+			options = append(options, probe.WithSMTP(mc.Hello))
+		case TypeIMAP:
+			options = append(options, probe.WithIMAP())
+		case TypePOP3:
+			options = append(options, probe.WithPOP3())
+		}
+		if mc.StartTLS {
+			options = append(options, probe.WithStartTLS())
+		}
+		return options, nil
+	case TypePostgres:
+		return []probe.Option{probe.WithPostgres()}, nil
+	case TypeMySQL:
+		return []probe.Option{probe.WithMySQL()}, nil
+	case TypeRedis:
+		return []probe.Option{probe.WithRedis()}, nil
+	case TypeExec:
+		var ec Exec
+		if pc.Exec != nil {
+			ec = *pc.Exec
+		}
+		options := []probe.Option{probe.WithExec(ec.Args...)}
+		keys := make([]string, 0, len(ec.Env))
+		for k := range ec.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			options = append(options, probe.WithExecEnv(k, ec.Env[k]))
+		}
+		return options, nil
+	default:
+		return nil, fmt.Errorf("%v: %q", ErrInvalidType, pc.Type)
+	}
+}
+
+// defaultFilter returns the success filter for a probe of its type
+// when none is configured
+func (pc Probe) defaultFilter() probe.ResultFilter {
+	switch pc.Type {
+	case TypeGRPC:
+		return probe.FilterHealthStatus("SERVING")
+	case TypeWebSocket:
+		// Accepts the handshake, or the first reply to any payload
+		return probe.FilterResponseCode(101)
+	case TypePing:
+		return probe.FilterMaxPacketLoss(0)
+	case TypeUDP, TypeIMAP, TypePOP3, TypePostgres, TypeMySQL, TypeRedis:
+		// Accepts any reply, as failing to get the expected one is an error
+		return probe.FilterResponseContains("")
+	case TypeSMTP:
+		return probe.FilterResponseCode(220)
+	case TypeExec:
+		// Expects the exit code of a plugin reporting OK
+		return probe.FilterResponseCode(0)
+	default:
+		return probe.FilterResponseCode(200)
+	}
+}
@@ -0,0 +1,283 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/sirupsen/logrus"
+)
+
+// AlertmanagerPath is the Alertmanager API path alerts are posted to
+const AlertmanagerPath = "/api/v2/alerts"
+
+// Alert is a single alert in the Alertmanager v2 API
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// Alertmanager pushes alerts to a Prometheus Alertmanager when a
+// probe goes down, re-sends them while it stays down, and resolves
+// them when it recovers. Alerts carry the probe's labels, and a kind
+// label with the probe's method or type, so that probes of the same
+// endpoint have separate alerts.
+type Alertmanager struct {
+	url          string
+	alertName    string
+	labels       map[string]string
+	resend       time.Duration
+	generatorURL string
+	client       *http.Client
+
+	processing sync.Mutex
+	firing     map[*probe.Probe]*firing
+	queue      [][]Alert
+	sending    bool
+
+	logger  logrus.StdLogger
+	pending sync.WaitGroup
+}
+
+// firing records an alert which has been sent and not yet resolved
+type firing struct {
+	startsAt time.Time
+	sentAt   time.Time
+}
+
+// AlertmanagerOption provides a way of configuring an Alertmanager
+// using variadic parameters when calling NewAlertmanager()
+type AlertmanagerOption func(*Alertmanager) error
+
+// NewAlertmanager is an Alertmanager constructor taking the base URL
+// of the Alertmanager (e.g. http://localhost:9093), which makes sure
+// defaults are applied then allows for variadic functional options
+// to be provided to further configure it.
+func NewAlertmanager(url string, options ...AlertmanagerOption) (*Alertmanager, error) {
+	if url == "" {
+		return nil, ErrInvalidURL
+	}
+
+	am := &Alertmanager{
+		url:       strings.TrimSuffix(url, "/") + AlertmanagerPath,
+		alertName: "AlienProbeFailed",
+		labels:    make(map[string]string),
+		resend:    time.Minute,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		firing:    make(map[*probe.Probe]*firing),
+		logger:    log.New(os.Stdout, "Alertmanager: ", 0),
+	}
+
+	for _, o := range options {
+		if err := o(am); err != nil {
+			return nil, err
+		}
+	}
+
+	return am, nil
+}
+
+// WithAlertName sets the alertname label of alerts
+//
+// If not used, the default is AlienProbeFailed
+func WithAlertName(name string) AlertmanagerOption {
+	return func(am *Alertmanager) error {
+		am.alertName = name
+		return nil
+	}
+}
+
+// WithAlertLabels adds static labels to every alert, overriding
+// any probe labels of the same name
+func WithAlertLabels(labels map[string]string) AlertmanagerOption {
+	return func(am *Alertmanager) error {
+		for k, v := range labels {
+			am.labels[k] = v
+		}
+		return nil
+	}
+}
+
+// WithAlertResend sets how often a firing alert is re-sent while
+// the probe stays down, so that Alertmanager does not resolve it
+//
+// If not used, the default is 1 minute
+func WithAlertResend(interval time.Duration) AlertmanagerOption {
+	return func(am *Alertmanager) error {
+		am.resend = interval
+		return nil
+	}
+}
+
+// WithAlertGeneratorURL sets the generatorURL of alerts, usually
+// a link back to the Alien instance
+func WithAlertGeneratorURL(url string) AlertmanagerOption {
+	return func(am *Alertmanager) error {
+		am.generatorURL = url
+		return nil
+	}
+}
+
+// WithAlertmanagerTimeout sets the timeout for posting alerts
+//
+// If not used, the default is 10 seconds
+func WithAlertmanagerTimeout(timeout time.Duration) AlertmanagerOption {
+	return func(am *Alertmanager) error {
+		am.client.Timeout = timeout
+		return nil
+	}
+}
+
+// WithAlertmanagerLogger sets the Alertmanager notifier's logger to use
+func WithAlertmanagerLogger(l logrus.StdLogger) AlertmanagerOption {
+	return func(am *Alertmanager) error {
+		am.logger = l
+		return nil
+	}
+}
+
+// Options returns the probe options which attach the notifier
+// to a probe's failure and success actions
+func (am *Alertmanager) Options() []probe.Option {
+	return []probe.Option{
+		probe.OnFailure(am.failure),
+		probe.OnSuccess(am.success),
+	}
+}
+
+// Wait blocks until all posts in progress have finished
+func (am *Alertmanager) Wait() {
+	am.pending.Wait()
+}
+
+// failure is the Action run when a probe fails, which fires an
+// alert or re-sends it once the resend interval has passed
+func (am *Alertmanager) failure(res probe.Result) {
+	am.processing.Lock()
+	f, ok := am.firing[res.Probe]
+	if ok && res.Timestamp.Sub(f.sentAt) < am.resend {
+		am.processing.Unlock()
+		return
+	}
+	if !ok {
+		f = &firing{startsAt: res.Timestamp}
+		am.firing[res.Probe] = f
+	}
+	f.sentAt = res.Timestamp
+	am.post(am.alert(res, f.startsAt))
+	am.processing.Unlock()
+}
+
+// success is the Action run when a probe succeeds, which resolves
+// the alert if one is firing
+func (am *Alertmanager) success(res probe.Result) {
+	am.processing.Lock()
+	f, ok := am.firing[res.Probe]
+	if !ok {
+		am.processing.Unlock()
+		return
+	}
+	delete(am.firing, res.Probe)
+	alert := am.alert(res, f.startsAt)
+	alert.EndsAt = &res.Timestamp
+	am.post(alert)
+	am.processing.Unlock()
+}
+
+// alert builds the Alert for a probe Result
+func (am *Alertmanager) alert(res probe.Result, startsAt time.Time) Alert {
+	e := NewEvent(res, StateDown)
+
+	labels := map[string]string{
+		"alertname": am.alertName,
+		"endpoint":  e.Endpoint,
+	}
+	for k, v := range e.Labels {
+		labels[k] = v
+	}
+	labels["kind"] = e.Kind
+	for k, v := range am.labels {
+		labels[k] = v
+	}
+
+	annotations := map[string]string{
+		"summary": fmt.Sprintf("%s is failing", e.Probe),
+	}
+	if e.Error != "" {
+		annotations["description"] = e.Error
+	} else {
+		annotations["description"] = fmt.Sprintf("response code %d", res.Code)
+	}
+
+	return Alert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     startsAt,
+		GeneratorURL: am.generatorURL,
+	}
+}
+
+// post queues the alerts to be sent in the background, starting a
+// sender if none is running. Alerts are sent one post at a time in
+// the order queued, so that a resolve never reaches Alertmanager
+// before the alert it ends. It must be called with processing held.
+func (am *Alertmanager) post(alerts ...Alert) {
+	am.pending.Add(1)
+	am.queue = append(am.queue, alerts)
+	if !am.sending {
+		am.sending = true
+		go am.send()
+	}
+}
+
+// send posts the queued alerts until the queue is empty
+func (am *Alertmanager) send() {
+	for {
+		am.processing.Lock()
+		if len(am.queue) == 0 {
+			am.sending = false
+			am.processing.Unlock()
+			return
+		}
+		alerts := am.queue[0]
+		am.queue = am.queue[1:]
+		am.processing.Unlock()
+
+		if err := am.Send(alerts...); err != nil {
+			am.logger.Printf("%v", err)
+		}
+		am.pending.Done()
+	}
+}
+
+// Send posts the alerts to Alertmanager
+func (am *Alertmanager) Send(alerts ...Alert) error {
+	payload, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	res, err := am.client.Post(am.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrDelivery, err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%v: unexpected response status %s", ErrDelivery, res.Status)
+	}
+	return nil
+}
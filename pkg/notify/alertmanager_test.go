@@ -0,0 +1,227 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/notify"
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestAlertmanagerLifecycle(t *testing.T) {
+	target := http.StatusServiceUnavailable
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(target)
+	}))
+	defer up.Close()
+
+	var mu sync.Mutex
+	var posts [][]notify.Alert
+	am := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != notify.AlertmanagerPath || req.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		var alerts []notify.Alert
+		if err := json.NewDecoder(req.Body).Decode(&alerts); err != nil {
+			t.Errorf("decode alerts: %v", err)
+		}
+		mu.Lock()
+		posts = append(posts, alerts)
+		mu.Unlock()
+	}))
+	defer am.Close()
+
+	n, err := notify.NewAlertmanager(am.URL+"/",
+		notify.WithAlertResend(0),
+		notify.WithAlertLabels(map[string]string{"team": "web"}),
+		notify.WithAlertmanagerLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewAlertmanager: %v", err)
+	}
+
+	options := append(n.Options(),
+		probe.WithLabels(map[string]string{"service": "shop"}),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	p, err := probe.New(up.URL, options...)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	// healthy first check sends nothing
+	target = http.StatusOK
+	p.Trigger()
+	n.Wait()
+
+	// down, re-sent while down, then resolved
+	target = http.StatusServiceUnavailable
+	p.Trigger()
+	n.Wait()
+	p.Trigger()
+	n.Wait()
+	target = http.StatusOK
+	p.Trigger()
+	n.Wait()
+
+	if len(posts) != 3 {
+		t.Fatalf("want 3 posts, got %d", len(posts))
+	}
+
+	first := posts[0][0]
+	if first.Labels["alertname"] != "AlienProbeFailed" || first.Labels["endpoint"] != up.URL || first.Labels["kind"] != "GET" || first.Labels["team"] != "web" || first.Labels["service"] != "shop" {
+		t.Errorf("unexpected labels: %v", first.Labels)
+	}
+	if first.EndsAt != nil {
+		t.Errorf("firing alert has endsAt %s", first.EndsAt)
+	}
+	if !posts[1][0].StartsAt.Equal(first.StartsAt) {
+		t.Errorf("re-sent alert startsAt changed: %s != %s", posts[1][0].StartsAt, first.StartsAt)
+	}
+	resolved := posts[2][0]
+	if resolved.EndsAt == nil || resolved.EndsAt.Before(first.StartsAt) {
+		t.Errorf("resolved alert has endsAt %v", resolved.EndsAt)
+	}
+}
+
+func TestAlertmanagerResendInterval(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	am := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		count++
+		mu.Unlock()
+	}))
+	defer am.Close()
+
+	n, err := notify.NewAlertmanager(am.URL,
+		notify.WithAlertResend(time.Hour),
+		notify.WithAlertmanagerLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewAlertmanager: %v", err)
+	}
+
+	options := append(n.Options(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	p, err := probe.New("http://127.0.0.1:0", options...)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	p.Trigger()
+	p.Trigger()
+	n.Wait()
+
+	if count != 1 {
+		t.Errorf("want 1 post within resend interval, got %d", count)
+	}
+}
+
+func TestAlertmanagerOrder(t *testing.T) {
+	target := http.StatusServiceUnavailable
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(target)
+	}))
+	defer up.Close()
+
+	// The firing alert is slow to arrive, so would be overtaken by
+	// its resolve if both were posted at once
+	var mu sync.Mutex
+	var posts []notify.Alert
+	am := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var alerts []notify.Alert
+		if err := json.NewDecoder(req.Body).Decode(&alerts); err != nil {
+			t.Errorf("decode alerts: %v", err)
+		}
+		if alerts[0].EndsAt == nil {
+			time.Sleep(100 * time.Millisecond)
+		}
+		mu.Lock()
+		posts = append(posts, alerts...)
+		mu.Unlock()
+	}))
+	defer am.Close()
+
+	n, err := notify.NewAlertmanager(am.URL, notify.WithAlertmanagerLogger(log.New(ioutil.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("NewAlertmanager: %v", err)
+	}
+	options := append(n.Options(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	p, err := probe.New(up.URL, options...)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	p.Trigger()
+	target = http.StatusOK
+	p.Trigger()
+	n.Wait()
+
+	if len(posts) != 2 || posts[0].EndsAt != nil || posts[1].EndsAt == nil {
+		t.Errorf("want firing alert then resolve, got %+v", posts)
+	}
+}
+
+func TestAlertmanagerKind(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	var mu sync.Mutex
+	var posts []notify.Alert
+	am := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var alerts []notify.Alert
+		if err := json.NewDecoder(req.Body).Decode(&alerts); err != nil {
+			t.Errorf("decode alerts: %v", err)
+		}
+		mu.Lock()
+		posts = append(posts, alerts...)
+		mu.Unlock()
+	}))
+	defer am.Close()
+
+	n, err := notify.NewAlertmanager(am.URL, notify.WithAlertmanagerLogger(log.New(ioutil.Discard, "", 0)))
+	if err != nil {
+		t.Fatalf("NewAlertmanager: %v", err)
+	}
+
+	// Probes of the same endpoint must not share an alert
+	for _, method := range []string{"GET", "POST"} {
+		options := append(n.Options(),
+			probe.WithMethod(method),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		p, err := probe.New(down.URL, options...)
+		if err != nil {
+			t.Fatalf("New probe: %v", err)
+		}
+		p.Trigger()
+	}
+	n.Wait()
+
+	if len(posts) != 2 {
+		t.Fatalf("want 2 alerts, got %+v", posts)
+	}
+	kinds := []string{posts[0].Labels["kind"], posts[1].Labels["kind"]}
+	sort.Strings(kinds)
+	if strings.Join(kinds, ",") != "GET,POST" {
+		t.Errorf("want alerts of kind GET and POST, got %v", kinds)
+	}
+}
@@ -0,0 +1,374 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/sirupsen/logrus"
+)
+
+// Default email templates, executed with a Digest
+const (
+	DefaultEmailSubject = `[Alien] {{len .Down}} down, {{len .Up}} recovered`
+	DefaultEmailText    = `{{range .Events}}{{.State | printf "%-4s"}} {{.Probe}}{{if .Error}}: {{.Error}}{{end}} ({{.Timestamp.Format "2006-01-02 15:04:05 MST"}})
+{{end}}`
+	DefaultEmailHTML = `<table>
+{{range .Events}}<tr><td>{{.State}}</td><td>{{.Probe}}</td><td>{{.Error}}</td><td>{{.Timestamp.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}</table>`
+)
+
+// Digest is a batch of events sent in a single email, and is
+// the data made available to email templates.
+type Digest struct {
+	Events []Event
+}
+
+// Down returns the events for probes which went down
+func (d Digest) Down() []Event {
+	return d.filter(StateDown)
+}
+
+// Up returns the events for probes which recovered
+func (d Digest) Up() []Event {
+	return d.filter(StateUp)
+}
+
+// filter returns the events in the given State
+func (d Digest) filter(s State) []Event {
+	var events []Event
+	for _, e := range d.Events {
+		if e.State == s {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Email sends an email over SMTP when probes change state,
+// batching changes which happen close together into a digest.
+type Email struct {
+	addr     string
+	from     string
+	to       []string
+	auth     smtp.Auth
+	tls      *tls.Config
+	startTLS bool
+
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+
+	window  time.Duration
+	tracker *Tracker
+
+	processing sync.Mutex
+	batch      []Event
+	timer      *time.Timer
+
+	logger  logrus.StdLogger
+	pending sync.WaitGroup
+}
+
+// EmailOption provides a way of configuring an Email using
+// variadic parameters when calling NewEmail()
+type EmailOption func(*Email) error
+
+// NewEmail is an Email constructor taking the SMTP server address
+// (host:port), sender and recipients, which makes sure defaults are
+// applied then allows for variadic functional options to be
+// provided to further configure it.
+func NewEmail(addr string, from string, to []string, options ...EmailOption) (*Email, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, ErrInvalidAddress
+	}
+	if from == "" || len(to) == 0 {
+		return nil, ErrInvalidRecipients
+	}
+
+	e := &Email{
+		addr:    addr,
+		from:    from,
+		to:      to,
+		tls:     &tls.Config{ServerName: host},
+		subject: template.Must(template.New("subject").Funcs(templateFuncs).Parse(DefaultEmailSubject)),
+		text:    template.Must(template.New("text").Funcs(templateFuncs).Parse(DefaultEmailText)),
+		html:    htmltemplate.Must(htmltemplate.New("html").Parse(DefaultEmailHTML)),
+		window:  30 * time.Second,
+		tracker: NewTracker(),
+		logger:  log.New(os.Stdout, "Email: ", 0),
+	}
+
+	for _, o := range options {
+		if err := o(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// WithEmailAuth sets the PLAIN authentication credentials for
+// the SMTP server. net/smtp refuses to send these unless the
+// connection is encrypted or to localhost.
+func WithEmailAuth(user string, pass string) EmailOption {
+	return func(e *Email) error {
+		host, _, _ := net.SplitHostPort(e.addr)
+		e.auth = smtp.PlainAuth("", user, pass, host)
+		return nil
+	}
+}
+
+// WithEmailStartTLS requires the connection be upgraded with
+// STARTTLS, using the given TLS configuration if not nil.
+//
+// If not used, STARTTLS is still used when the server offers it
+func WithEmailStartTLS(config *tls.Config) EmailOption {
+	return func(e *Email) error {
+		e.startTLS = true
+		if config != nil {
+			e.tls = config
+		}
+		return nil
+	}
+}
+
+// WithEmailTemplates sets the subject, plain text and HTML templates,
+// each executed with a Digest. An empty string keeps the default,
+// and an html of "-" sends plain text only.
+func WithEmailTemplates(subject string, text string, html string) EmailOption {
+	return func(e *Email) error {
+		var err error
+		if subject != "" {
+			if e.subject, err = template.New("subject").Funcs(templateFuncs).Parse(subject); err != nil {
+				return err
+			}
+		}
+		if text != "" {
+			if e.text, err = template.New("text").Funcs(templateFuncs).Parse(text); err != nil {
+				return err
+			}
+		}
+		switch html {
+		case "":
+		case "-":
+			e.html = nil
+		default:
+			if e.html, err = htmltemplate.New("html").Parse(html); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithEmailDigest sets how long to wait after a state change for
+// others to batch into the same email. Zero sends each change on
+// its own.
+//
+// If not used, the default is 30 seconds
+func WithEmailDigest(window time.Duration) EmailOption {
+	return func(e *Email) error {
+		e.window = window
+		return nil
+	}
+}
+
+// WithEmailLogger sets the email notifier's logger to use
+func WithEmailLogger(l logrus.StdLogger) EmailOption {
+	return func(e *Email) error {
+		e.logger = l
+		return nil
+	}
+}
+
+// Options returns the probe options which attach the notifier
+// to a probe's failure and success actions
+func (e *Email) Options() []probe.Option {
+	return []probe.Option{
+		probe.OnFailure(e.failure),
+		probe.OnSuccess(e.success),
+	}
+}
+
+// Flush sends any batched events now rather than waiting for
+// the digest window to close
+func (e *Email) Flush() {
+	e.processing.Lock()
+	if e.timer != nil {
+		// A timer stopped before it fired never marks its window as
+		// done, so that is left to Flush once the email is sent
+		if e.timer.Stop() {
+			defer e.pending.Done()
+		}
+		e.timer = nil
+	}
+	batch := e.batch
+	e.batch = nil
+	e.processing.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := e.Send(Digest{Events: batch}); err != nil {
+		e.logger.Printf("%v", err)
+	}
+}
+
+// Wait blocks until the current digest window has closed and its
+// email has been sent
+func (e *Email) Wait() {
+	e.pending.Wait()
+}
+
+// failure is the Action run when a probe fails
+func (e *Email) failure(res probe.Result) {
+	e.notify(res, StateDown)
+}
+
+// success is the Action run when a probe succeeds
+func (e *Email) success(res probe.Result) {
+	e.notify(res, StateUp)
+}
+
+// notify adds the event to the batch if the probe's state has
+// changed, opening a digest window if one is not already open
+func (e *Email) notify(res probe.Result, s State) {
+	if !Changed(e.tracker.Update(res.Probe, s), s) {
+		return
+	}
+
+	e.processing.Lock()
+	defer e.processing.Unlock()
+
+	e.batch = append(e.batch, NewEvent(res, s))
+	if e.timer != nil {
+		return
+	}
+
+	e.pending.Add(1)
+	e.timer = time.AfterFunc(e.window, func() {
+		defer e.pending.Done()
+		e.Flush()
+	})
+}
+
+// Send renders the digest and delivers it over SMTP
+func (e *Email) Send(d Digest) error {
+	msg, err := e.message(d)
+	if err != nil {
+		return err
+	}
+
+	c, err := smtp.Dial(e.addr)
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrDelivery, err)
+	}
+	defer c.Close()
+
+	if err := e.deliver(c, msg); err != nil {
+		return fmt.Errorf("%v: %v", ErrDelivery, err)
+	}
+	return c.Quit()
+}
+
+// deliver carries out the SMTP conversation on a connected client
+func (e *Email) deliver(c *smtp.Client, msg []byte) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(e.tls); err != nil {
+			return err
+		}
+	} else if e.startTLS {
+		return ErrStartTLSUnsupported
+	}
+
+	if e.auth != nil {
+		if err := c.Auth(e.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	for _, rcpt := range e.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// message renders the digest as a MIME message
+func (e *Email) message(d Digest) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := e.subject.Execute(&subject, d); err != nil {
+		return nil, err
+	}
+	if err := e.text.Execute(&text, d); err != nil {
+		return nil, err
+	}
+	if e.html != nil {
+		if err := e.html.Execute(&html, d); err != nil {
+			return nil, err
+		}
+	}
+
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+
+	if e.html == nil {
+		fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.Write(text.Bytes())
+		return msg.Bytes(), nil
+	}
+
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write(part.body)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return msg.Bytes(), nil
+}
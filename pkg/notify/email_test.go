@@ -0,0 +1,204 @@
+package notify_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/notify"
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// smtpSink is a minimal SMTP server which records each message
+type smtpSink struct {
+	net.Listener
+
+	mu         sync.Mutex
+	messages   []string
+	recipients [][]string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &smtpSink{Listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var rcpts []string
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			rcpts = append(rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil || l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.recipients = append(s.recipients, rcpts)
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	sink := newSMTPSink(t)
+	defer sink.Close()
+
+	e, err := notify.NewEmail(sink.Addr().String(), "alien@example.com",
+		[]string{"ops@example.com", "web@example.com"},
+		notify.WithEmailDigest(50*time.Millisecond),
+		notify.WithEmailLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewEmail: %v", err)
+	}
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		options := append(e.Options(),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		p, err := probe.New(down.URL+path, options...)
+		if err != nil {
+			t.Fatalf("New probe: %v", err)
+		}
+		p.Trigger()
+		p.Trigger()
+	}
+	e.Wait()
+
+	if len(sink.messages) != 1 {
+		t.Fatalf("want 1 digest email, got %d", len(sink.messages))
+	}
+
+	msg := sink.messages[0]
+	if !strings.Contains(msg, "Subject: [Alien] 3 down, 0 recovered") {
+		t.Errorf("unexpected subject in message:\n%s", msg)
+	}
+	if !strings.Contains(msg, "multipart/alternative") || !strings.Contains(msg, "<table>") {
+		t.Errorf("message is missing the HTML part:\n%s", msg)
+	}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if !strings.Contains(msg, down.URL+path) {
+			t.Errorf("message is missing probe %s:\n%s", path, msg)
+		}
+	}
+	if len(sink.recipients[0]) != 2 {
+		t.Errorf("want 2 recipients, got %v", sink.recipients[0])
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	sink := newSMTPSink(t)
+	defer sink.Close()
+
+	e, err := notify.NewEmail(sink.Addr().String(), "alien@example.com", []string{"ops@example.com"},
+		notify.WithEmailStartTLS(nil),
+	)
+	if err != nil {
+		t.Fatalf("NewEmail: %v", err)
+	}
+
+	err = e.Send(notify.Digest{Events: []notify.Event{{State: notify.StateDown}}})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("want STARTTLS error, got %v", err)
+	}
+}
+
+func TestEmailFlush(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	sink := newSMTPSink(t)
+	defer sink.Close()
+
+	e, err := notify.NewEmail(sink.Addr().String(), "alien@example.com", []string{"ops@example.com"},
+		notify.WithEmailDigest(time.Hour),
+		notify.WithEmailLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewEmail: %v", err)
+	}
+	options := append(e.Options(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	p, err := probe.New(down.URL, options...)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	p.Trigger()
+
+	// Flushing sends the digest without waiting for its window, and
+	// leaves nothing for Wait to block on
+	e.Flush()
+	waited := make(chan struct{})
+	go func() {
+		e.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait blocked after Flush")
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.messages) != 1 {
+		t.Errorf("want 1 flushed email, got %d", len(sink.messages))
+	}
+}
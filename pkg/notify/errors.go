@@ -0,0 +1,21 @@
+package notify
+
+// Error is a string which satisfies the error interface
+type Error string
+
+// Error implements the error interface
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Define error constants
+const (
+	ErrInvalidURL     = Error("notifier invalid: url")
+	ErrInvalidRetries = Error("notifier invalid: retries is negative")
+	ErrInvalidPayload = Error("notifier invalid: payload is not valid JSON")
+	ErrDelivery       = Error("notifier delivery failed")
+
+	ErrInvalidAddress      = Error("notifier invalid: address")
+	ErrInvalidRecipients   = Error("notifier invalid: sender and recipients required")
+	ErrStartTLSUnsupported = Error("notifier delivery failed: server does not support STARTTLS")
+)
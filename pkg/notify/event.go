@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// Event describes a probe state change, and is the data
+// made available to notification templates.
+type Event struct {
+	Probe     string
+	Kind      string
+	Endpoint  string
+	Labels    map[string]string
+	State     State
+	Error     string
+	Latency   time.Duration
+	Timestamp time.Time
+
+	Result probe.Result
+}
+
+// NewEvent builds an Event from a probe Result
+func NewEvent(res probe.Result, s State) Event {
+	e := Event{
+		State:     s,
+		Latency:   res.Latency,
+		Timestamp: res.Timestamp,
+		Result:    res,
+	}
+	if res.Probe != nil {
+		e.Probe = res.Probe.String()
+		e.Kind = res.Probe.Kind()
+		e.Endpoint = res.Probe.Endpoint()
+		e.Labels = res.Probe.Labels()
+	}
+	if res.Error != nil {
+		e.Error = res.Error.Error()
+	}
+	return e
+}
+
+// templateFuncs are the functions available to notification templates
+var templateFuncs = map[string]interface{}{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"milliseconds": func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	},
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// State is the health of a probe as seen by a notifier
+type State string
+
+// Define probe states
+const (
+	StateDown State = "down"
+	StateUp   State = "up"
+)
+
+// Tracker remembers the last known State of each probe so
+// that notifiers only act on transitions.
+type Tracker struct {
+	processing sync.Mutex
+	states     map[*probe.Probe]State
+}
+
+// NewTracker is a constructor for a Tracker
+func NewTracker() *Tracker {
+	return &Tracker{
+		states: make(map[*probe.Probe]State),
+	}
+}
+
+// Update records the State of the probe and returns the
+// previous State, which is empty if the probe has not been
+// seen before.
+func (t *Tracker) Update(p *probe.Probe, s State) State {
+	t.processing.Lock()
+	defer t.processing.Unlock()
+
+	previous := t.states[p]
+	t.states[p] = s
+	return previous
+}
+
+// Changed reports whether moving from the previous State to
+// the next one is worth notifying about. A probe which is up
+// on its first check has not recovered from anything.
+func Changed(previous State, next State) bool {
+	if previous == next {
+		return false
+	}
+	return previous != "" || next == StateDown
+}
@@ -0,0 +1,309 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/sirupsen/logrus"
+)
+
+// SignatureHeader is the request header carrying the HMAC-SHA256
+// signature of the payload when a webhook secret is set
+const SignatureHeader = "X-Alien-Signature"
+
+// DefaultWebhookTemplate is the payload sent when no template is given
+const DefaultWebhookTemplate = `{` +
+	`"probe":{{json .Probe}},` +
+	`"endpoint":{{json .Endpoint}},` +
+	`"labels":{{json .Labels}},` +
+	`"state":{{json .State}},` +
+	`"error":{{json .Error}},` +
+	`"latency_ms":{{milliseconds .Latency}},` +
+	`"timestamp":{{json .Timestamp}}` +
+	`}`
+
+// Webhook POSTs a templated JSON payload to a URL when a
+// probe starts failing and when it recovers.
+type Webhook struct {
+	url      string
+	secret   []byte
+	template *template.Template
+	retries  int
+	backoff  time.Duration
+	client   *http.Client
+	tracker  *Tracker
+
+	deadLetter io.Writer
+	logger     logrus.StdLogger
+
+	processing sync.Mutex
+	queue      []Event
+	sending    bool
+
+	pending sync.WaitGroup
+}
+
+// WebhookOption provides a way of configuring a Webhook using
+// variadic parameters when calling NewWebhook()
+type WebhookOption func(*Webhook) error
+
+// NewWebhook is a Webhook constructor which makes sure defaults
+// are applied then allows for variadic functional options to
+// be provided to further configure the webhook.
+func NewWebhook(url string, options ...WebhookOption) (*Webhook, error) {
+	if url == "" {
+		return nil, ErrInvalidURL
+	}
+
+	w := &Webhook{
+		url:      url,
+		template: template.Must(template.New("webhook").Funcs(templateFuncs).Parse(DefaultWebhookTemplate)),
+		retries:  3,
+		backoff:  time.Second,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		tracker:  NewTracker(),
+		logger:   log.New(os.Stdout, "Webhook: ", 0),
+	}
+
+	for _, o := range options {
+		if err := o(w); err != nil {
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// WithWebhookTemplate sets the text/template used to render the
+// JSON payload. The template is executed with an Event.
+func WithWebhookTemplate(text string) WebhookOption {
+	return func(w *Webhook) error {
+		t, err := template.New("webhook").Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return err
+		}
+		w.template = t
+		return nil
+	}
+}
+
+// WithWebhookSecret signs each payload with HMAC-SHA256 using the
+// secret, sending the signature in the SignatureHeader header
+func WithWebhookSecret(secret string) WebhookOption {
+	return func(w *Webhook) error {
+		w.secret = []byte(secret)
+		return nil
+	}
+}
+
+// WithWebhookTimeout sets the timeout for each delivery attempt
+//
+// If not used, the default is 10 seconds
+func WithWebhookTimeout(timeout time.Duration) WebhookOption {
+	return func(w *Webhook) error {
+		w.client.Timeout = timeout
+		return nil
+	}
+}
+
+// WithWebhookRetries sets how many times a failed delivery is
+// retried, waiting backoff before the first retry and doubling
+// the wait each time after.
+//
+// If not used, the default is 3 retries with a 1 second backoff
+func WithWebhookRetries(retries int, backoff time.Duration) WebhookOption {
+	return func(w *Webhook) error {
+		if retries < 0 {
+			return ErrInvalidRetries
+		}
+		w.retries = retries
+		w.backoff = backoff
+		return nil
+	}
+}
+
+// WithWebhookDeadLetter sets where payloads which could not be
+// delivered are written, one JSON object per line
+func WithWebhookDeadLetter(dl io.Writer) WebhookOption {
+	return func(w *Webhook) error {
+		w.deadLetter = dl
+		return nil
+	}
+}
+
+// WithWebhookLogger sets the webhook's logger to use
+func WithWebhookLogger(l logrus.StdLogger) WebhookOption {
+	return func(w *Webhook) error {
+		w.logger = l
+		return nil
+	}
+}
+
+// Options returns the probe options which attach the webhook
+// to a probe's failure and success actions
+func (w *Webhook) Options() []probe.Option {
+	return []probe.Option{
+		probe.OnFailure(w.failure),
+		probe.OnSuccess(w.success),
+	}
+}
+
+// Wait blocks until all deliveries in progress have finished
+func (w *Webhook) Wait() {
+	w.pending.Wait()
+}
+
+// failure is the Action run when a probe fails
+func (w *Webhook) failure(res probe.Result) {
+	w.notify(res, StateDown)
+}
+
+// success is the Action run when a probe succeeds
+func (w *Webhook) success(res probe.Result) {
+	w.notify(res, StateUp)
+}
+
+// notify sends the event in the background if the probe's
+// state has changed
+func (w *Webhook) notify(res probe.Result, s State) {
+	w.processing.Lock()
+	defer w.processing.Unlock()
+
+	if !Changed(w.tracker.Update(res.Probe, s), s) {
+		return
+	}
+	w.post(NewEvent(res, s))
+}
+
+// post queues the event to be sent in the background, starting a
+// sender if none is running. Events are sent one at a time in the
+// order queued, retries included, so that a recovery never reaches
+// the receiver before the failure it follows. It must be called
+// with processing held.
+func (w *Webhook) post(e Event) {
+	w.pending.Add(1)
+	w.queue = append(w.queue, e)
+	if !w.sending {
+		w.sending = true
+		go w.send()
+	}
+}
+
+// send delivers the queued events until the queue is empty
+func (w *Webhook) send() {
+	for {
+		w.processing.Lock()
+		if len(w.queue) == 0 {
+			w.sending = false
+			w.processing.Unlock()
+			return
+		}
+		event := w.queue[0]
+		w.queue = w.queue[1:]
+		w.processing.Unlock()
+
+		if err := w.Send(event); err != nil {
+			w.logger.Printf("%s: %v", event.Probe, err)
+		}
+		w.pending.Done()
+	}
+}
+
+// Send renders and delivers the event, retrying on failure. If
+// every attempt fails the payload is written to the dead-letter
+// log and an error is returned.
+func (w *Webhook) Send(e Event) error {
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, e); err != nil {
+		w.dead(buf.Bytes(), err)
+		return err
+	}
+	payload := buf.Bytes()
+
+	if !json.Valid(payload) {
+		w.dead(payload, ErrInvalidPayload)
+		return ErrInvalidPayload
+	}
+
+	var err error
+	wait := w.backoff
+	for attempt := 0; attempt <= w.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		if err = w.deliver(payload); err == nil {
+			return nil
+		}
+		w.logger.Printf("Delivery attempt %d to %s failed: %v", attempt+1, w.url, err)
+	}
+
+	w.dead(payload, err)
+	return fmt.Errorf("%v: %v", ErrDelivery, err)
+}
+
+// deliver makes a single delivery attempt
+func (w *Webhook) deliver(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.secret, payload))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", res.Status)
+	}
+	return nil
+}
+
+// dead writes an undeliverable payload to the dead-letter log
+func (w *Webhook) dead(payload []byte, reason error) {
+	if w.deadLetter == nil {
+		return
+	}
+
+	line, err := json.Marshal(struct {
+		Time    time.Time `json:"time"`
+		URL     string    `json:"url"`
+		Error   string    `json:"error"`
+		Payload string    `json:"payload"`
+	}{time.Now(), w.url, reason.Error(), string(payload)})
+	if err != nil {
+		w.logger.Printf("Dead-letter encoding failed: %v", err)
+		return
+	}
+
+	if _, err := w.deadLetter.Write(append(line, '\n')); err != nil {
+		w.logger.Printf("Dead-letter write failed: %v", err)
+	}
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the payload
+func Sign(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
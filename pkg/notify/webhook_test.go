@@ -0,0 +1,191 @@
+package notify_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/notify"
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+type received struct {
+	sync.Mutex
+	payloads   [][]byte
+	signatures []string
+}
+
+func (r *received) handler(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		b, _ := ioutil.ReadAll(req.Body)
+		r.Lock()
+		r.payloads = append(r.payloads, b)
+		r.signatures = append(r.signatures, req.Header.Get(notify.SignatureHeader))
+		r.Unlock()
+		w.WriteHeader(status)
+	}
+}
+
+func TestWebhookTransitions(t *testing.T) {
+	target := http.StatusServiceUnavailable
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(target)
+	}))
+	defer up.Close()
+
+	var rec received
+	hook := httptest.NewServer(rec.handler(http.StatusOK))
+	defer hook.Close()
+
+	w, err := notify.NewWebhook(hook.URL,
+		notify.WithWebhookSecret("s3cret"),
+		notify.WithWebhookLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+
+	options := append(w.Options(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	p, err := probe.New(up.URL, options...)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	// down, still down, recovered, still up
+	p.Trigger()
+	p.Trigger()
+	target = http.StatusOK
+	p.Trigger()
+	p.Trigger()
+	w.Wait()
+
+	if len(rec.payloads) != 2 {
+		t.Fatalf("want 2 deliveries, got %d", len(rec.payloads))
+	}
+
+	var states []string
+	for i, b := range rec.payloads {
+		var body map[string]interface{}
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Fatalf("payload %d is not JSON: %v: %s", i, err, b)
+		}
+		if body["endpoint"] != up.URL {
+			t.Errorf("payload %d endpoint: want %s got %v", i, up.URL, body["endpoint"])
+		}
+		if want := "sha256=" + notify.Sign([]byte("s3cret"), b); rec.signatures[i] != want {
+			t.Errorf("payload %d signature: want %s got %s", i, want, rec.signatures[i])
+		}
+		states = append(states, body["state"].(string))
+	}
+	if strings.Join(states, ",") != "down,up" {
+		t.Errorf("want states down,up got %v", states)
+	}
+}
+
+func TestWebhookOrder(t *testing.T) {
+	target := http.StatusServiceUnavailable
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(target)
+	}))
+	defer up.Close()
+
+	// The first delivery fails, so the down event would be overtaken
+	// by the up event while waiting to be retried
+	var mu sync.Mutex
+	var states []string
+	attempts := 0
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		states = append(states, body["state"].(string))
+	}))
+	defer hook.Close()
+
+	w, err := notify.NewWebhook(hook.URL,
+		notify.WithWebhookRetries(1, 100*time.Millisecond),
+		notify.WithWebhookLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	options := append(w.Options(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	p, err := probe.New(up.URL, options...)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	p.Trigger()
+	target = http.StatusOK
+	p.Trigger()
+	w.Wait()
+
+	if strings.Join(states, ",") != "down,up" {
+		t.Errorf("want states down,up got %v", states)
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var rec received
+	hook := httptest.NewServer(rec.handler(http.StatusInternalServerError))
+	defer hook.Close()
+
+	var dl bytes.Buffer
+	w, err := notify.NewWebhook(hook.URL,
+		notify.WithWebhookRetries(2, time.Millisecond),
+		notify.WithWebhookDeadLetter(&dl),
+		notify.WithWebhookLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+
+	if err := w.Send(notify.Event{Endpoint: "http://example.invalid", State: notify.StateDown}); err == nil {
+		t.Fatal("want delivery error, got nil")
+	}
+
+	if len(rec.payloads) != 3 {
+		t.Errorf("want 3 attempts, got %d", len(rec.payloads))
+	}
+
+	var entry map[string]string
+	if err := json.Unmarshal(dl.Bytes(), &entry); err != nil {
+		t.Fatalf("dead-letter entry is not JSON: %v: %s", err, dl.Bytes())
+	}
+	if entry["url"] != hook.URL || !strings.Contains(entry["payload"], "example.invalid") {
+		t.Errorf("unexpected dead-letter entry: %v", entry)
+	}
+}
+
+func TestWebhookInvalidTemplate(t *testing.T) {
+	w, err := notify.NewWebhook("http://example.invalid",
+		notify.WithWebhookTemplate(`{"state": {{.State}}}`),
+		notify.WithWebhookLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+
+	if err := w.Send(notify.Event{State: notify.StateDown}); err != notify.ErrInvalidPayload {
+		t.Errorf("want %v, got %v", notify.ErrInvalidPayload, err)
+	}
+}
@@ -0,0 +1,84 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// defaultDatabaseTimeout is how long a database check may take when
+// the probe has no timeout set with WithClient
+const defaultDatabaseTimeout = 10 * time.Second
+
+// databaseEndpoint renders the endpoint of a database probe, which
+// must have one of the schemes, and returns it with the query or
+// command to run
+func (p *Probe) databaseEndpoint(schemes ...string) (*url.URL, string, error) {
+	endpoint, _, query, err := p.renderRequest()
+	if err != nil {
+		return nil, "", err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// The error would include the endpoint, and any password in it
+		return nil, "", fmt.Errorf("%w: invalid endpoint URL", ErrDatabase)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return u, query, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w: endpoint scheme must be %s", ErrDatabase, schemes[0])
+}
+
+// dialDatabase connects to the database at the URL, on the port if
+// the URL has none, with the connection's deadline set for the whole
+// of the check
+func (p *Probe) dialDatabase(ctx context.Context, u *url.URL, port string) (net.Conn, error) {
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	conn, err := p.dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// databaseTimeout returns the context for a database check, which is
+// limited by the probe's timeout
+func (p *Probe) databaseTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := p.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultDatabaseTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// tlsConfig returns the probe's TLS configuration for connecting to
+// the host, for probes which upgrade connections to TLS themselves
+func (p *Probe) tlsConfig(host string) *tls.Config {
+	config := p.transport.TLSClientConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return config
+}
+
+// upgradeTLS performs a TLS handshake over the connection, recording
+// the connection state on the Result
+func (p *Probe) upgradeTLS(conn net.Conn, host string, res *Result) (net.Conn, error) {
+	tc := tls.Client(conn, p.tlsConfig(host))
+	if err := tc.Handshake(); err != nil {
+		return nil, fmt.Errorf("%w: TLS handshake: %v", ErrDatabase, err)
+	}
+	state := tc.ConnectionState()
+	res.TLS = &state
+	return tc, nil
+}
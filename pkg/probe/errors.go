@@ -14,5 +14,33 @@ const (
 	ErrInvalidMethod             = Error("probe invalid: method")
 	ErrInvalidFrequencyZero      = Error("probe invalid: frequency is zero")
 	ErrInvalidSuccessFilterEmpty = Error("probe invalid: no success filter")
+	ErrInvalidLabel              = Error("probe invalid: label")
+	ErrInvalidTLS                = Error("probe invalid: TLS")
+	ErrInvalidIPVersion          = Error("probe invalid: IP version must be 4 or 6")
+	ErrInvalidSourceAddress      = Error("probe invalid: source address")
+	ErrInvalidProxy              = Error("probe invalid: proxy")
+	ErrInvalidResolver           = Error("probe invalid: resolver")
+	ErrInvalidHostOverride       = Error("probe invalid: host override")
+	ErrInvalidOAuth2             = Error("probe invalid: OAuth2")
+	ErrInvalidPayload            = Error("probe invalid: payload")
+	ErrInvalidPing               = Error("probe invalid: ping")
+	ErrInvalidExecEnv            = Error("probe invalid: exec environment variable")
+	ErrInvalidRedirectLimit      = Error("probe invalid: redirect limit is negative")
+	ErrInvalidTemplate           = Error("probe invalid: template")
+	ErrInvalidSteps              = Error("probe invalid: steps")
+	ErrInvalidExtract            = Error("probe invalid: extract expression")
+	ErrInvalidEachAddress        = Error("probe invalid: each address")
+	ErrExtractNotFound           = Error("probe extract: value not found")
+	ErrStepFailed                = Error("probe step failed")
+	ErrAddressFailed             = Error("probe address failed")
+	ErrProxy                     = Error("probe proxy failed")
+	ErrToken                     = Error("probe token failed")
+	ErrGRPC                      = Error("probe gRPC call failed")
+	ErrWebSocket                 = Error("probe WebSocket failed")
+	ErrPing                      = Error("probe ping failed")
+	ErrUDP                       = Error("probe UDP failed")
+	ErrMail                      = Error("probe mail protocol failed")
+	ErrDatabase                  = Error("probe database failed")
+	ErrExec                      = Error("probe command failed")
 	ErrFilterAlreadySet          = Error("probe with success filter: filter already set")
 )
@@ -0,0 +1,244 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultExecTimeout is how long a command may run when the probe
+// has no timeout set with WithClient
+const defaultExecTimeout = 10 * time.Second
+
+// execWaitDelay is how long to wait for the output of a command to
+// close once it has exited or been killed, in case it left children
+// running which hold on to it
+const execWaitDelay = time.Second
+
+// Perfdata is a single value of the performance data output by a
+// Nagios plugin, written as 'label'=value[unit];[warn];[crit];[min];[max]
+// where the thresholds and limits are kept as written
+type Perfdata struct {
+	Label string
+	Value float64
+	Unit  string
+	Warn  string
+	Crit  string
+	Min   string
+	Max   string
+}
+
+// limitedBuffer keeps the first maxBodySize bytes written to it,
+// discarding the rest so that a command is never blocked writing
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+// Write implements io.Writer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxBodySize - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// doExec runs the command named by the endpoint and records its exit
+// code and output on the given Result
+func (p *Probe) doExec(ctx context.Context, res *Result) error {
+	command, _, stdin, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	vars := map[string]string{}
+	args := make([]string, len(p.execArgs))
+	for i, arg := range p.execArgs {
+		if args[i], err = render(arg, vars, p.templateSecrets); err != nil {
+			return err
+		}
+	}
+	env := os.Environ()
+	for _, kv := range p.execEnv {
+		rendered, err := render(kv, vars, p.templateSecrets)
+		if err != nil {
+			return err
+		}
+		env = append(env, rendered)
+	}
+
+	timeout := p.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = execWaitDelay
+
+	err = cmd.Run()
+	res.Body = stdout.String()
+	res.Stderr = stderr.String()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w: timed out after %s", ErrExec, timeout)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && exitErr.Exited():
+		res.Code = exitErr.ExitCode()
+	case err != nil:
+		return fmt.Errorf("%w: %v", ErrExec, err)
+	}
+	res.Perfdata = parsePerfdata(res.Body)
+	return nil
+}
+
+// parsePerfdata reads the performance data in the output of a Nagios
+// plugin, which follows a | on the first line, and a | on any later
+// line along with every line after it. Values which could not be
+// determined, written as U, are left out.
+func parsePerfdata(output string) []Perfdata {
+	lines := strings.Split(output, "\n")
+	var text []string
+	if i := strings.IndexByte(lines[0], '|'); i >= 0 {
+		text = append(text, lines[0][i+1:])
+	}
+	for n, line := range lines[1:] {
+		if i := strings.IndexByte(line, '|'); i >= 0 {
+			text = append(text, line[i+1:])
+			text = append(text, lines[n+2:]...)
+			break
+		}
+	}
+
+	var perfdata []Perfdata
+	for _, item := range splitPerfdata(strings.Join(text, " ")) {
+		if pd, ok := parsePerfItem(item); ok {
+			perfdata = append(perfdata, pd)
+		}
+	}
+	return perfdata
+}
+
+// splitPerfdata splits performance data into its space separated
+// items, removing the single quotes around labels, within which two
+// quotes in a row stand for one
+func splitPerfdata(s string) []string {
+	var items []string
+	var item strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' && quoted && i+1 < len(s) && s[i+1] == '\'':
+			item.WriteByte('\'')
+			i++
+		case c == '\'':
+			quoted = !quoted
+		case !quoted && (c == ' ' || c == '\t' || c == '\r'):
+			if item.Len() > 0 {
+				items = append(items, item.String())
+				item.Reset()
+			}
+		default:
+			item.WriteByte(c)
+		}
+	}
+	if item.Len() > 0 {
+		items = append(items, item.String())
+	}
+	return items
+}
+
+// parsePerfItem parses a single item of performance data, which
+// must be UTF-8 to be exported as a metric
+func parsePerfItem(item string) (Perfdata, bool) {
+	eq := strings.LastIndexByte(item, '=')
+	if eq <= 0 || !utf8.ValidString(item) {
+		return Perfdata{}, false
+	}
+	fields := strings.Split(item[eq+1:], ";")
+	pd := Perfdata{Label: item[:eq]}
+
+	// The value is a number, possibly in exponent form, followed by
+	// its unit
+	v := fields[0]
+	end := 0
+	for end < len(v) {
+		c := v[end]
+		if c >= '0' && c <= '9' || c == '.' || c == '-' || c == '+' {
+			end++
+			continue
+		}
+		if (c == 'e' || c == 'E') && end+1 < len(v) && strings.IndexByte("0123456789+-", v[end+1]) >= 0 {
+			end++
+			continue
+		}
+		break
+	}
+	value, err := strconv.ParseFloat(v[:end], 64)
+	if err != nil {
+		return Perfdata{}, false
+	}
+	pd.Value = value
+	pd.Unit = v[end:]
+
+	for i, threshold := range []*string{&pd.Warn, &pd.Crit, &pd.Min, &pd.Max} {
+		if i+1 < len(fields) {
+			*threshold = fields[i+1]
+		}
+	}
+	return pd, true
+}
+
+// WithExec makes the probe run a local command, named by the
+// endpoint, with the arguments, so that checks such as Nagios plugins
+// can be wrapped. The command's exit code is the Code of the Result,
+// its standard output the Body, and its standard error the Stderr.
+// The payload, set with WithPayload, is sent to its standard input.
+// Arguments may be templates, which are evaluated on every check.
+//
+// Performance data in Nagios plugin output, such as
+// "DISK OK | /=2643MB;5948;5958;0;5968", is recorded as the Perfdata
+// of the Result and exported as the alien_probe_perfdata metric,
+// which holds only the values output by the latest check. A
+// command which cannot be run, is killed, or runs for longer than
+// the timeout set with WithClient, or else 10 seconds, is an ErrExec
+// error.
+func WithExec(args ...string) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.execArgs = args
+		p.kind = "EXEC"
+		p.checker = p.doExec
+		return nil
+	}
+}
+
+// WithExecEnv sets an environment variable for the command run by the
+// probe, in addition to the environment of the process, where the
+// value may be a template such as {{secret "/run/secrets/token"}} if
+// the probe is made with WithTemplateSecrets
+func WithExecEnv(key string, value string) Option {
+	return func(p *Probe) error {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("%v: %q", ErrInvalidExecEnv, key)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.execEnv = append(p.execEnv, key+"="+value)
+		return nil
+	}
+}
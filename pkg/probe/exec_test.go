@@ -0,0 +1,179 @@
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExec(t *testing.T) {
+	var execSets = []struct {
+		name     string
+		script   string
+		options  []probe.Option
+		code     int
+		body     string
+		stderr   string
+		perfdata []probe.Perfdata
+		execErr  bool
+	}{
+		{
+			name:   "ok",
+			script: `echo "DISK OK - free space: / 3326 MB (56%)|/=2643MB;5948;5958;0;5968 'inode ''used'''=12%;80;90 fresh=U"; echo note >&2`,
+			body:   "DISK OK - free space: / 3326 MB (56%)|/=2643MB;5948;5958;0;5968 'inode ''used'''=12%;80;90 fresh=U\n",
+			stderr: "note\n",
+			perfdata: []probe.Perfdata{
+				{Label: "/", Value: 2643, Unit: "MB", Warn: "5948", Crit: "5958", Min: "0", Max: "5968"},
+				{Label: "inode 'used'", Value: 12, Unit: "%", Warn: "80", Crit: "90"},
+			},
+		},
+		{
+			name:   "long output",
+			script: `printf 'LOAD WARNING|load1=2.5\nper cpu\n|load5=1.25e+00;4:;8: load15=-0.5s\n'; exit 1`,
+			code:   1,
+			body:   "LOAD WARNING|load1=2.5\nper cpu\n|load5=1.25e+00;4:;8: load15=-0.5s\n",
+			perfdata: []probe.Perfdata{
+				{Label: "load1", Value: 2.5},
+				{Label: "load5", Value: 1.25, Warn: "4:", Crit: "8:"},
+				{Label: "load15", Value: -0.5, Unit: "s"},
+			},
+		},
+		{
+			name:     "invalid utf-8",
+			script:   `printf 'OK|\377=1 up=1\n'`,
+			body:     "OK|\377=1 up=1\n",
+			perfdata: []probe.Perfdata{{Label: "up", Value: 1}},
+		},
+		{
+			name:    "environment and input",
+			script:  `read line; echo "$line $ALIEN_GREETING"; exit 2`,
+			options: []probe.Option{probe.WithPayload("hello\n"), probe.WithExecEnv("ALIEN_GREETING", "{{env \"ALIEN_TEST_NAME\"}}"), probe.WithTemplateSecrets()},
+			code:    2,
+			body:    "hello world\n",
+		},
+		{
+			name:    "timeout",
+			script:  `exec sleep 5`,
+			options: []probe.Option{probe.WithClient(100 * time.Millisecond)},
+			execErr: true,
+		},
+		{
+			name:    "killed",
+			script:  `kill -9 $$`,
+			execErr: true,
+		},
+	}
+
+	t.Setenv("ALIEN_TEST_NAME", "world")
+	for _, es := range execSets {
+		options := append([]probe.Option{
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithExec("-c", es.script),
+			probe.WithSuccessFilter(probe.FilterResponseCode(0)),
+		}, es.options...)
+		p, err := probe.New("/bin/sh", options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", es.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", es.name, err)
+		}
+		if es.execErr {
+			if !errors.Is(res.Error, probe.ErrExec) {
+				t.Errorf("%s: want exec error, got %v", es.name, res.Error)
+			}
+			continue
+		}
+		if res.Error != nil || res.Code != es.code || res.Success != (es.code == 0) {
+			t.Errorf("%s: want exit code %d, got %d %t %v", es.name, es.code, res.Code, res.Success, res.Error)
+		}
+		if res.Body != es.body || res.Stderr != es.stderr {
+			t.Errorf("%s: want output %q %q, got %q %q", es.name, es.body, es.stderr, res.Body, res.Stderr)
+		}
+		if !reflect.DeepEqual(res.Perfdata, es.perfdata) {
+			t.Errorf("%s: want perfdata %+v, got %+v", es.name, es.perfdata, res.Perfdata)
+		}
+	}
+}
+
+func TestExecNotFound(t *testing.T) {
+	p, err := probe.New("/nonexistent/check_alien",
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithExec(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	res, err := p.Check(context.Background())
+	if err != nil || !errors.Is(res.Error, probe.ErrExec) {
+		t.Errorf("want exec error, got %v %v", err, res.Error)
+	}
+}
+
+func TestExecPerfdataMetrics(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "output")
+	p, err := probe.New("/bin/sh",
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithExec("-c", "cat "+output),
+		probe.WithLabels(map[string]string{"team": "perfdata"}),
+		probe.WithSuccessFilter(probe.FilterResponseCode(0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	// Series which a check no longer outputs are removed
+	for _, ps := range []struct {
+		output string
+		series []string
+	}{
+		{output: "OK|a=1 b=2s", series: []string{"a= 1", "b=s 2"}},
+		{output: "OK|a=3 \xff=4", series: []string{"a= 3"}},
+		{output: "OK"},
+	} {
+		if err := os.WriteFile(output, []byte(ps.output), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Trigger(); err != nil {
+			t.Fatalf("%q: Trigger: %v", ps.output, err)
+		}
+
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatalf("%q: Gather: %v", ps.output, err)
+		}
+		var series []string
+		for _, f := range families {
+			if f.GetName() != "alien_probe_perfdata" {
+				continue
+			}
+			for _, m := range f.GetMetric() {
+				labels := map[string]string{}
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				if labels["team"] == "perfdata" {
+					series = append(series, fmt.Sprintf("%s=%s %g", labels["label"], labels["unit"], m.GetGauge().GetValue()))
+				}
+			}
+		}
+		sort.Strings(series)
+		if !reflect.DeepEqual(series, ps.series) {
+			t.Errorf("%q: want series %q, got %q", ps.output, ps.series, series)
+		}
+	}
+}
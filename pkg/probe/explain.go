@@ -0,0 +1,35 @@
+package probe
+
+// Explanation is the outcome of checking a ResultFilter against a
+// Result, along with the outcome of each of its members, so that
+// it is clear which clause of a filter caused it to fail.
+type Explanation struct {
+	Filter  ResultFilter
+	Pass    bool
+	Members []Explanation
+}
+
+// Explain checks the filter and every member of any filter groups
+// against the Result. Members are always all checked, rather than
+// stopping at the first which decides the group.
+func Explain(filter ResultFilter, res *Result) Explanation {
+	e := Explanation{
+		Filter: filter,
+		Pass:   filter.Check(res),
+	}
+
+	switch f := filter.(type) {
+	case FilterGroupAll:
+		for _, m := range f.Members {
+			e.Members = append(e.Members, Explain(m, res))
+		}
+	case FilterGroupAny:
+		for _, m := range f.Members {
+			e.Members = append(e.Members, Explain(m, res))
+		}
+	case FilterGroupNot:
+		e.Members = append(e.Members, Explain(f.Member, res))
+	}
+
+	return e
+}
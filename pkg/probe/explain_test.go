@@ -0,0 +1,48 @@
+package probe_test
+
+import (
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestExplain(t *testing.T) {
+	filter := probe.FilterGroupAll{
+		Members: []probe.ResultFilter{
+			probe.FilterResponseCode(200),
+			probe.FilterGroupNot{Member: probe.FilterResponseContains("error")},
+			probe.FilterGroupAny{
+				Members: []probe.ResultFilter{
+					probe.FilterResponseContains("ok"),
+					probe.FilterResponseContains("healthy"),
+				},
+			},
+		},
+	}
+
+	e := probe.Explain(filter, &probe.Result{Code: 200, Body: "error: not ok"})
+
+	if e.Pass {
+		t.Errorf("want filter to fail")
+	}
+	if len(e.Members) != 3 {
+		t.Fatalf("want 3 members, got %d", len(e.Members))
+	}
+
+	want := []bool{true, false, true}
+	for i, m := range e.Members {
+		if m.Pass != want[i] {
+			t.Errorf("member %d %v: want pass=%t", i, m.Filter, want[i])
+		}
+	}
+
+	not := e.Members[1]
+	if len(not.Members) != 1 || !not.Members[0].Pass {
+		t.Errorf("want not member to explain its passing member, got %+v", not)
+	}
+
+	any := e.Members[2]
+	if len(any.Members) != 2 || !any.Members[0].Pass || any.Members[1].Pass {
+		t.Errorf("want every any member explained, got %+v", any)
+	}
+}
@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Extract takes a value from a Result, as described by the
+// expression, which is one of:
+//
+//	json:path.to.value   a value from a JSON body, indexing arrays by number
+//	header:Name          the first value of a response header
+//	regex:pattern        the first capture group (or whole match) in the body
+func Extract(res *Result, expr string) (string, error) {
+	kv := strings.SplitN(expr, ":", 2)
+	if len(kv) != 2 {
+		return "", fmt.Errorf("%v: %q", ErrInvalidExtract, expr)
+	}
+
+	switch kv[0] {
+	case "json":
+		return extractJSON(res.Body, kv[1])
+	case "header":
+		if v := res.Headers.Get(kv[1]); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%v: no header %q", ErrExtractNotFound, kv[1])
+	case "regex":
+		re, err := regexp.Compile(kv[1])
+		if err != nil {
+			return "", fmt.Errorf("%v: %v", ErrInvalidExtract, err)
+		}
+		m := re.FindStringSubmatch(res.Body)
+		switch {
+		case m == nil:
+			return "", fmt.Errorf("%v: no match for %q", ErrExtractNotFound, kv[1])
+		case len(m) > 1:
+			return m[1], nil
+		default:
+			return m[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("%v: %q", ErrInvalidExtract, expr)
+}
+
+// extractJSON walks the dot separated path through a JSON body
+func extractJSON(body string, path string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("%v: body is not JSON: %v", ErrExtractNotFound, err)
+	}
+
+	for _, seg := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			next, ok := node[seg]
+			if !ok {
+				return "", fmt.Errorf("%v: no field %q in %q", ErrExtractNotFound, seg, path)
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("%v: no index %q in %q", ErrExtractNotFound, seg, path)
+			}
+			v = node[i]
+		default:
+			return "", fmt.Errorf("%v: %q is not an object or array in %q", ErrExtractNotFound, seg, path)
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -2,7 +2,9 @@ package probe
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ResultFilter describes an interface for checking
@@ -38,6 +40,110 @@ func (f FilterResponseContains) Check(res *Result) bool {
 	return strings.Contains(res.Body, string(f))
 }
 
+// FilterFinalURL filters on the final URL requested, after
+// following any redirects, equaling the string
+type FilterFinalURL string
+
+// String implements the Stringer interface
+func (f FilterFinalURL) String() string {
+	return fmt.Sprintf("<FinalURL=%s>", string(f))
+}
+
+// Check filters when the final URL is equal
+func (f FilterFinalURL) Check(res *Result) bool {
+	return res.URL == string(f)
+}
+
+// FilterRedirectCount filters on the number of redirects
+// followed equaling the int
+type FilterRedirectCount int
+
+// String implements the Stringer interface
+func (f FilterRedirectCount) String() string {
+	return fmt.Sprintf("<Redirects=%d>", f)
+}
+
+// Check filters when the number of redirects is equal
+func (f FilterRedirectCount) Check(res *Result) bool {
+	return len(res.Redirects) == int(f)
+}
+
+// FilterHealthStatus filters on the serving status reported by a
+// gRPC health check equaling the string, such as SERVING
+type FilterHealthStatus string
+
+// String implements the Stringer interface
+func (f FilterHealthStatus) String() string {
+	return fmt.Sprintf("<HealthStatus=%s>", string(f))
+}
+
+// Check filters when the serving status is equal
+func (f FilterHealthStatus) Check(res *Result) bool {
+	return res.HealthStatus == string(f)
+}
+
+// FilterMaxValue filters on the response Body being a number which
+// is at most the float, such as the replication lag returned by a
+// database query
+type FilterMaxValue float64
+
+// String implements the Stringer interface
+func (f FilterMaxValue) String() string {
+	return fmt.Sprintf("<Value≤%g>", float64(f))
+}
+
+// Check filters when the Body, ignoring surrounding whitespace, is a
+// number no more than the float
+func (f FilterMaxValue) Check(res *Result) bool {
+	v, err := strconv.ParseFloat(strings.TrimSpace(res.Body), 64)
+	return err == nil && v <= float64(f)
+}
+
+// FilterCapability filters on a mail server offering the capability
+// named by the string, ignoring case and any parameters, so that
+// "AUTH" matches "AUTH PLAIN LOGIN"
+type FilterCapability string
+
+// String implements the Stringer interface
+func (f FilterCapability) String() string {
+	return fmt.Sprintf("<Capability=%s>", string(f))
+}
+
+// Check filters when the capability is offered
+func (f FilterCapability) Check(res *Result) bool {
+	return hasCapability(res.Capabilities, string(f))
+}
+
+// FilterMaxPacketLoss filters on the percentage of ping requests
+// unanswered being at most the float
+type FilterMaxPacketLoss float64
+
+// String implements the Stringer interface
+func (f FilterMaxPacketLoss) String() string {
+	return fmt.Sprintf("<PacketLoss≤%g%%>", float64(f))
+}
+
+// Check filters when the packet loss is no more than the percentage,
+// and at least one ping request was sent
+func (f FilterMaxPacketLoss) Check(res *Result) bool {
+	return res.PacketsSent > 0 && res.PacketLoss <= float64(f)
+}
+
+// FilterMaxRTT filters on the average round trip time of ping
+// replies being at most the duration
+type FilterMaxRTT time.Duration
+
+// String implements the Stringer interface
+func (f FilterMaxRTT) String() string {
+	return fmt.Sprintf("<RTT≤%s>", time.Duration(f))
+}
+
+// Check filters when the average round trip time is no more than the
+// duration, and at least one reply was received
+func (f FilterMaxRTT) Check(res *Result) bool {
+	return res.PacketsReceived > 0 && res.RTTAvg <= time.Duration(f)
+}
+
 // FilterGroupAll is true when all the member ResultFilter
 // checks are true
 type FilterGroupAll struct {
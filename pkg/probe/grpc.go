@@ -0,0 +1,194 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// grpcHealthCheckPath is the path of the Check method of the gRPC
+// health checking protocol service, grpc.health.v1.Health
+const grpcHealthCheckPath = "/grpc.health.v1.Health/Check"
+
+// healthStatuses are the names of the serving statuses in a
+// grpc.health.v1.HealthCheckResponse
+var healthStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// doGRPC calls the Check method of the gRPC health service and
+// records the serving status on the given Result
+func (p *Probe) doGRPC(ctx context.Context, res *Result) error {
+	endpoint, headers, _, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	u.Path = grpcHealthCheckPath
+
+	// HealthCheckRequest has the service name as field 1
+	var msg []byte
+	if p.grpcService != "" {
+		msg = append([]byte{0x0a}, encodeVarint(uint64(len(p.grpcService)))...)
+		msg = append(msg, p.grpcService...)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(grpcFrame(msg)))
+	if err != nil {
+		return err
+	}
+	setHeaders(req, headers)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	if err := p.roundTrip(req, res); err != nil {
+		return err
+	}
+	if res.Code != http.StatusOK {
+		return fmt.Errorf("%w: HTTP status %d", ErrGRPC, res.Code)
+	}
+
+	// A call which fails straight away has its status in the headers
+	status := res.Trailers.Get("Grpc-Status")
+	message := res.Trailers.Get("Grpc-Message")
+	if status == "" {
+		status = res.Headers.Get("Grpc-Status")
+		message = res.Headers.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("%w: no status", ErrGRPC)
+	}
+	res.GRPCStatus = code
+	if code != 0 {
+		if m, err := url.PathUnescape(message); err == nil && m != "" {
+			return fmt.Errorf("%w: status %d: %s", ErrGRPC, code, m)
+		}
+		return fmt.Errorf("%w: status %d", ErrGRPC, code)
+	}
+
+	msg, err = grpcMessage([]byte(res.Body))
+	if err != nil {
+		return err
+	}
+	serving, err := healthStatus(msg)
+	if err != nil {
+		return err
+	}
+	res.HealthStatus = serving
+	return nil
+}
+
+// grpcFrame prefixes an uncompressed message with its length, as
+// sent in the body of gRPC requests and responses
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// grpcMessage returns the first message in a gRPC response body
+func grpcMessage(body []byte) ([]byte, error) {
+	if len(body) < 5 {
+		return nil, fmt.Errorf("%w: no response message", ErrGRPC)
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("%w: compressed response message", ErrGRPC)
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < n {
+		return nil, fmt.Errorf("%w: truncated response message", ErrGRPC)
+	}
+	return body[5 : 5+n], nil
+}
+
+// healthStatus decodes the serving status, field 1, of a
+// HealthCheckResponse, skipping any other fields
+func healthStatus(msg []byte) (string, error) {
+	var status uint64
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return "", fmt.Errorf("%w: invalid response message", ErrGRPC)
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return "", fmt.Errorf("%w: invalid response message", ErrGRPC)
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = v
+			}
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(msg) < size {
+				return "", fmt.Errorf("%w: invalid response message", ErrGRPC)
+			}
+			msg = msg[size:]
+		case 2:
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return "", fmt.Errorf("%w: invalid response message", ErrGRPC)
+			}
+			msg = msg[n+int(l):]
+		default:
+			return "", fmt.Errorf("%w: invalid response message", ErrGRPC)
+		}
+	}
+
+	if name, ok := healthStatuses[status]; ok {
+		return name, nil
+	}
+	return strconv.FormatUint(status, 10), nil
+}
+
+// encodeVarint returns v as a protobuf varint
+func encodeVarint(v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, v)]
+}
+
+// WithGRPCHealth makes the probe call the Check method of the gRPC
+// health checking protocol, grpc.health.v1.Health, for the service
+// or for the server as a whole if the service is empty. The endpoint
+// is http://host:port for plaintext or https://host:port for TLS, and
+// headers set with WithHeader are sent as metadata.
+//
+// The serving status, such as SERVING or NOT_SERVING, is recorded as
+// the HealthStatus of the Result and can be checked with
+// FilterHealthStatus. A call which fails is an ErrGRPC error.
+func WithGRPCHealth(service string) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+
+		// gRPC is only spoken over HTTP/2, including without TLS
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		p.transport.Protocols = protocols
+
+		p.grpcService = service
+		p.method = http.MethodPost
+		p.kind = "GRPC"
+		p.checker = p.doGRPC
+		return nil
+	}
+}
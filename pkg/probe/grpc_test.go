@@ -0,0 +1,114 @@
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// healthHandler implements grpc.health.v1.Health/Check, reporting
+// the server as SERVING, the service "down" as NOT_SERVING, and any
+// other service as not found. The metadata header x-token must be
+// "alien".
+func healthHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != "/grpc.health.v1.Health/Check" || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected request %s %s %s", r.Proto, r.URL.Path, r.Header.Get("Content-Type"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		if r.Header.Get("X-Token") != "alien" {
+			w.Header().Set("Grpc-Status", "16")
+			w.Header().Set("Grpc-Message", "missing%20token")
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var service string
+		if len(body) > 7 {
+			service = string(body[7:])
+		}
+
+		var status byte
+		switch service {
+		case "":
+			status = 1
+		case "down":
+			status = 2
+		default:
+			w.Header().Set("Grpc-Status", "5")
+			return
+		}
+
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, status})
+		w.Header().Set("Grpc-Status", "0")
+	})
+}
+
+func TestGRPCHealth(t *testing.T) {
+	plain := httptest.NewUnstartedServer(healthHandler(t))
+	plain.Config.Protocols = new(http.Protocols)
+	plain.Config.Protocols.SetUnencryptedHTTP2(true)
+	plain.Start()
+	defer plain.Close()
+
+	secure := httptest.NewUnstartedServer(healthHandler(t))
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+
+	var grpcSets = []struct {
+		name     string
+		endpoint string
+		service  string
+		token    string
+		status   string
+		code     int
+	}{
+		{name: "plaintext", endpoint: plain.URL, token: "alien", status: "SERVING"},
+		{name: "tls", endpoint: secure.URL, token: "alien", status: "SERVING"},
+		{name: "not serving", endpoint: plain.URL, service: "down", token: "alien", status: "NOT_SERVING"},
+		{name: "unknown service", endpoint: plain.URL, service: "other", token: "alien", code: 5},
+		{name: "unauthenticated", endpoint: plain.URL, code: 16},
+	}
+
+	for _, gs := range grpcSets {
+		p, err := probe.New(gs.endpoint,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithGRPCHealth(gs.service),
+			probe.WithHeader("x-token", gs.token),
+			probe.WithTLSInsecureSkipVerify(),
+			probe.WithSuccessFilter(probe.FilterHealthStatus("SERVING")),
+		)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", gs.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", gs.name, err)
+		}
+		if gs.code != 0 {
+			if !errors.Is(res.Error, probe.ErrGRPC) || res.GRPCStatus != gs.code {
+				t.Errorf("%s: want gRPC status %d, got %d %v", gs.name, gs.code, res.GRPCStatus, res.Error)
+			}
+			continue
+		}
+		if res.Error != nil {
+			t.Errorf("%s: Check: %v", gs.name, res.Error)
+			continue
+		}
+		if res.HealthStatus != gs.status || res.Success != (gs.status == "SERVING") {
+			t.Errorf("%s: want %s, got %s (success %t)", gs.name, gs.status, res.HealthStatus, res.Success)
+		}
+	}
+}
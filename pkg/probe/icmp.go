@@ -0,0 +1,272 @@
+package probe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// defaultPingTimeout is how long to wait for replies after the last
+// echo request is sent when the probe has no timeout set with WithClient
+const defaultPingTimeout = time.Second
+
+// pingPayloadSize is the size of the data sent in each echo request,
+// as sent by ping by default
+const pingPayloadSize = 56
+
+// ICMP message types of echo requests and replies
+const (
+	icmpv4EchoReply   = 0
+	icmpv4EchoRequest = 8
+	icmpv6EchoRequest = 128
+	icmpv6EchoReply   = 129
+)
+
+// pingChecks counts the ping checks made, giving each its own echo
+// identifier so that concurrent checks of the same host on raw
+// connections do not count each other's replies
+var pingChecks atomic.Uint32
+
+// pingConn is a connection for sending ICMP echo requests. On
+// datagram connections the kernel sets the echo identifier and only
+// delivers replies to our own requests, but on raw connections every
+// ICMP message received is read.
+type pingConn struct {
+	net.PacketConn
+	datagram bool
+}
+
+// pingReply is an echo reply received for the request with the
+// sequence number
+type pingReply struct {
+	seq      int
+	received time.Time
+}
+
+// listenICMP opens an unprivileged datagram ICMP socket where the
+// system permits, otherwise a raw ICMP socket, bound to the source
+// IP address if it is not nil
+func listenICMP(ipv6 bool, source net.IP) (*pingConn, error) {
+	if conn, err := listenICMPDatagram(ipv6, source); err == nil {
+		return &pingConn{PacketConn: conn, datagram: true}, nil
+	}
+
+	network, address := "ip4:icmp", "0.0.0.0"
+	if ipv6 {
+		network, address = "ip6:ipv6-icmp", "::"
+	}
+	if source != nil {
+		address = source.String()
+	}
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPing, err)
+	}
+	return &pingConn{PacketConn: conn}, nil
+}
+
+// doPing sends echo requests to the endpoint host and records the
+// replies received on the given Result
+func (p *Probe) doPing(ctx context.Context, res *Result) error {
+	host, _, _, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	addrs, err := p.lookup(ctx, host)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(addrs[0])
+	ipv6 := ip.To4() == nil
+
+	// The source address set with WithSourceAddress must be of the
+	// same IP version as the host
+	var source net.IP
+	if local, ok := p.dialer.LocalAddr.(*net.TCPAddr); ok {
+		source = local.IP
+		if (source.To4() == nil) != ipv6 {
+			return fmt.Errorf("%w: source address %s cannot reach %s", ErrPing, source, ip)
+		}
+	}
+	conn, err := listenICMP(ipv6, source)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if conn.datagram {
+		dst = &net.UDPAddr{IP: ip}
+	}
+	id := int(uint32(os.Getpid())+pingChecks.Add(1)) & 0xffff
+
+	replies := make(chan pingReply, p.pingCount)
+	go readEchoReplies(conn, ip, id, replies)
+
+	timeout := p.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+
+	sent := make([]time.Time, p.pingCount)
+	rtts := make([]time.Duration, p.pingCount)
+	send := time.NewTimer(0)
+	defer send.Stop()
+	var deadline <-chan time.Time
+
+	for seq, received := 0, 0; received < p.pingCount; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-send.C:
+			if _, err := conn.WriteTo(echoRequest(ipv6, id, seq), dst); err != nil {
+				return fmt.Errorf("%w: %v", ErrPing, err)
+			}
+			sent[seq] = time.Now()
+			res.PacketsSent++
+			seq++
+			if seq < p.pingCount {
+				send.Reset(p.pingInterval)
+			} else {
+				timer := time.NewTimer(timeout)
+				defer timer.Stop()
+				deadline = timer.C
+			}
+
+		case r := <-replies:
+			if r.seq < seq && rtts[r.seq] == 0 {
+				rtts[r.seq] = r.received.Sub(sent[r.seq])
+				received++
+			}
+
+		case <-deadline:
+			received = p.pingCount
+		}
+	}
+
+	// Replies are summarised in the order the requests were sent
+	var total, jitter time.Duration
+	var last time.Duration
+	for _, rtt := range rtts {
+		if rtt == 0 {
+			continue
+		}
+		if len(res.RTTs) == 0 || rtt < res.RTTMin {
+			res.RTTMin = rtt
+		}
+		if rtt > res.RTTMax {
+			res.RTTMax = rtt
+		}
+		if len(res.RTTs) > 0 {
+			diff := rtt - last
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+		}
+		total += rtt
+		last = rtt
+		res.RTTs = append(res.RTTs, rtt)
+	}
+
+	res.PacketsReceived = len(res.RTTs)
+	res.PacketLoss = 100 * float64(res.PacketsSent-res.PacketsReceived) / float64(res.PacketsSent)
+	if res.PacketsReceived > 0 {
+		res.RTTAvg = total / time.Duration(res.PacketsReceived)
+	}
+	if res.PacketsReceived > 1 {
+		res.Jitter = jitter / time.Duration(res.PacketsReceived-1)
+	}
+	return nil
+}
+
+// readEchoReplies sends each echo reply from the IP address for the
+// identifier on the channel, until the connection is closed
+func readEchoReplies(conn *pingConn, ip net.IP, id int, replies chan<- pingReply) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		received := time.Now()
+		if n < 8 || (buf[0] != icmpv4EchoReply && buf[0] != icmpv6EchoReply) {
+			continue
+		}
+		if !conn.datagram {
+			if addr, ok := from.(*net.IPAddr); !ok || !addr.IP.Equal(ip) {
+				continue
+			}
+			if int(binary.BigEndian.Uint16(buf[4:6])) != id {
+				continue
+			}
+		}
+
+		select {
+		case replies <- pingReply{seq: int(binary.BigEndian.Uint16(buf[6:8])), received: received}:
+		default:
+		}
+	}
+}
+
+// echoRequest returns an ICMP echo request message. The checksum of
+// ICMPv6 messages is always filled in by the kernel.
+func echoRequest(ipv6 bool, id int, seq int) []byte {
+	msg := make([]byte, 8+pingPayloadSize)
+	msg[0] = icmpv4EchoRequest
+	if ipv6 {
+		msg[0] = icmpv6EchoRequest
+	}
+	binary.BigEndian.PutUint16(msg[4:], uint16(id))
+	binary.BigEndian.PutUint16(msg[6:], uint16(seq))
+	for i := 8; i < len(msg); i++ {
+		msg[i] = byte(i)
+	}
+
+	if !ipv6 {
+		var sum uint32
+		for i := 0; i < len(msg); i += 2 {
+			sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+		}
+		sum = sum>>16 + sum&0xffff
+		sum += sum >> 16
+		binary.BigEndian.PutUint16(msg[2:], ^uint16(sum))
+	}
+	return msg
+}
+
+// WithPing makes the probe send count ICMP echo requests to the
+// endpoint, which is a host name or IP address, waiting interval
+// between each. Linux unprivileged ICMP sockets are used where the
+// ping_group_range sysctl allows, otherwise raw sockets, which need
+// root or CAP_NET_RAW. Requests are sent from the address set with
+// WithSourceAddress, which must be of the same IP version as the
+// host, if one is set.
+//
+// The packets sent and received, percentage packet loss, minimum,
+// average and maximum round trip time and jitter are recorded on the
+// Result, and can be checked with FilterMaxPacketLoss and FilterMaxRTT.
+// Replies are waited for until the timeout set with WithClient, or
+// else one second, after the last request is sent.
+func WithPing(count int, interval time.Duration) Option {
+	return func(p *Probe) error {
+		if count <= 0 || count > 1<<16 {
+			return fmt.Errorf("%v: count %d", ErrInvalidPing, count)
+		}
+		if interval < 0 {
+			return fmt.Errorf("%v: interval %s", ErrInvalidPing, interval)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.pingCount = count
+		p.pingInterval = interval
+		p.kind = "PING"
+		p.checker = p.doPing
+		return nil
+	}
+}
@@ -0,0 +1,35 @@
+package probe
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenICMPDatagram opens an unprivileged ICMP socket, which Linux
+// permits for the groups in the net.ipv4.ping_group_range sysctl
+func listenICMPDatagram(ipv6 bool, source net.IP) (net.PacketConn, error) {
+	family, proto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	sa4 := &syscall.SockaddrInet4{}
+	copy(sa4.Addr[:], source.To4())
+	var sa syscall.Sockaddr = sa4
+	if ipv6 {
+		family, proto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+		sa6 := &syscall.SockaddrInet6{}
+		copy(sa6.Addr[:], source.To16())
+		sa = sa6
+	}
+
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
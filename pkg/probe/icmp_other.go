@@ -0,0 +1,13 @@
+//go:build !linux
+
+package probe
+
+import (
+	"errors"
+	"net"
+)
+
+// listenICMPDatagram always fails, so that raw sockets are used
+func listenICMPDatagram(ipv6 bool, source net.IP) (net.PacketConn, error) {
+	return nil, errors.New("unprivileged ICMP sockets not supported")
+}
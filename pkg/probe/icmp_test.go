@@ -0,0 +1,105 @@
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestPing(t *testing.T) {
+	p, err := probe.New("127.0.0.1",
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithPing(3, 10*time.Millisecond),
+		probe.WithClient(500*time.Millisecond),
+		probe.WithSuccessFilter(probe.FilterMaxPacketLoss(0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	res, err := p.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if errors.Is(res.Error, probe.ErrPing) {
+		t.Skipf("ICMP sockets not permitted: %v", res.Error)
+	}
+	if res.Error != nil || !res.Success {
+		t.Fatalf("want success, got %t %v", res.Success, res.Error)
+	}
+	if res.PacketsSent != 3 || res.PacketsReceived != 3 || len(res.RTTs) != 3 || res.PacketLoss != 0 {
+		t.Errorf("want 3 sent and received, got %d %d %v (%g%% loss)", res.PacketsSent, res.PacketsReceived, res.RTTs, res.PacketLoss)
+	}
+	if res.RTTMin <= 0 || res.RTTMin > res.RTTAvg || res.RTTAvg > res.RTTMax {
+		t.Errorf("want min <= avg <= max, got %s %s %s", res.RTTMin, res.RTTAvg, res.RTTMax)
+	}
+}
+
+func TestPingSourceAddress(t *testing.T) {
+	var sourceSets = []struct {
+		source  string
+		success bool
+	}{
+		{source: "127.0.0.1", success: true},
+		{source: "192.0.2.1"},
+		{source: "::1"},
+	}
+
+	for _, ss := range sourceSets {
+		p, err := probe.New("127.0.0.1",
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithPing(1, 10*time.Millisecond),
+			probe.WithSourceAddress(ss.source),
+			probe.WithClient(500*time.Millisecond),
+			probe.WithSuccessFilter(probe.FilterMaxPacketLoss(0)),
+		)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", ss.source, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", ss.source, err)
+		}
+		if ss.success {
+			if errors.Is(res.Error, probe.ErrPing) {
+				t.Skipf("ICMP sockets not permitted: %v", res.Error)
+			}
+			if res.Error != nil || !res.Success {
+				t.Errorf("%s: want success, got %t %v", ss.source, res.Success, res.Error)
+			}
+			continue
+		}
+		if !errors.Is(res.Error, probe.ErrPing) {
+			t.Errorf("%s: want ping error, got %v", ss.source, res.Error)
+		}
+	}
+}
+
+func TestPingFilters(t *testing.T) {
+	var filterSets = []struct {
+		name   string
+		filter probe.ResultFilter
+		result probe.Result
+		want   bool
+	}{
+		{name: "no loss", filter: probe.FilterMaxPacketLoss(0), result: probe.Result{PacketsSent: 4, PacketsReceived: 4}, want: true},
+		{name: "loss within", filter: probe.FilterMaxPacketLoss(25), result: probe.Result{PacketsSent: 4, PacketsReceived: 3, PacketLoss: 25}, want: true},
+		{name: "loss over", filter: probe.FilterMaxPacketLoss(20), result: probe.Result{PacketsSent: 4, PacketsReceived: 3, PacketLoss: 25}},
+		{name: "nothing sent", filter: probe.FilterMaxPacketLoss(100), result: probe.Result{}},
+		{name: "rtt within", filter: probe.FilterMaxRTT(time.Millisecond), result: probe.Result{PacketsReceived: 1, RTTAvg: time.Millisecond}, want: true},
+		{name: "rtt over", filter: probe.FilterMaxRTT(time.Millisecond), result: probe.Result{PacketsReceived: 1, RTTAvg: 2 * time.Millisecond}},
+		{name: "no replies", filter: probe.FilterMaxRTT(time.Second), result: probe.Result{PacketsSent: 1, PacketLoss: 100}},
+	}
+
+	for _, fs := range filterSets {
+		if got := fs.filter.Check(&fs.result); got != fs.want {
+			t.Errorf("%s: %v want %t, got %t", fs.name, fs.filter, fs.want, got)
+		}
+	}
+}
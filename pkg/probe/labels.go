@@ -0,0 +1,73 @@
+package probe
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// labelNameRE matches valid Prometheus label names
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// reservedLabels are the label names used by the probe's own metrics
+var reservedLabels = map[string]bool{
+	"address":  true,
+	"endpoint": true,
+	"label":    true,
+	"step":     true,
+	"success":  true,
+	"unit":     true,
+}
+
+// ValidateLabel checks a label name and value against the
+// Prometheus label rules, and that the name is not one the
+// probe metrics already use.
+func ValidateLabel(name string, value string) error {
+	if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("%v: name %q", ErrInvalidLabel, name)
+	}
+	if reservedLabels[name] {
+		return fmt.Errorf("%v: name %q is reserved", ErrInvalidLabel, name)
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%v: value of %q is not UTF-8", ErrInvalidLabel, name)
+	}
+	return nil
+}
+
+// Labels returns a copy of the probe's labels
+func (p *Probe) Labels() map[string]string {
+	labels := make(map[string]string, len(p.labels))
+	for k, v := range p.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// MatchLabels reports whether the probe has every label in the
+// selector with the same value. An empty selector matches all probes.
+func (p *Probe) MatchLabels(selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := p.labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// labelString formats labels in Prometheus style, sorted by name
+func labelString(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", k, labels[k])
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
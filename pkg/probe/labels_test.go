@@ -0,0 +1,110 @@
+package probe_test
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labelSets = []struct {
+	labels map[string]string
+	valid  bool
+}{
+	{labels: map[string]string{"team": "web"}, valid: true},
+	{labels: map[string]string{"_env": "prod", "service2": "api"}, valid: true},
+	{labels: map[string]string{"2team": "web"}, valid: false},
+	{labels: map[string]string{"team-name": "web"}, valid: false},
+	{labels: map[string]string{"__name__": "x"}, valid: false},
+	{labels: map[string]string{"endpoint": "x"}, valid: false},
+	{labels: map[string]string{"address": "x"}, valid: false},
+	{labels: map[string]string{"label": "x"}, valid: false},
+	{labels: map[string]string{"unit": "x"}, valid: false},
+	{labels: map[string]string{"team": "\xff"}, valid: false},
+}
+
+func TestWithLabelsValidation(t *testing.T) {
+	for _, ls := range labelSets {
+		_, err := probe.New("http://example.invalid",
+			probe.WithLabels(ls.labels),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		if (err == nil) != ls.valid {
+			t.Errorf("labels %v: want valid=%t, got %v", ls.labels, ls.valid, err)
+		}
+	}
+}
+
+func TestLabelsString(t *testing.T) {
+	p, err := probe.New("http://example.invalid",
+		probe.WithLabels(map[string]string{"team": "web", "env": "prod"}),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	want := `Probe<GET 'http://example.invalid' every 10s {env="prod",team="web"}>`
+	if p.String() != want {
+		t.Errorf("want %s got %s", want, p.String())
+	}
+
+	if !p.MatchLabels(map[string]string{"team": "web"}) || p.MatchLabels(map[string]string{"team": "db"}) {
+		t.Errorf("unexpected label match for %s", p)
+	}
+}
+
+func TestLabelsMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	for _, labels := range []map[string]string{
+		{"team": "metrics-a"},
+		{"team": "metrics-b", "env": "prod"},
+	} {
+		p, err := probe.New(srv.URL,
+			probe.WithLabels(labels),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		if err != nil {
+			t.Fatalf("New probe: %v", err)
+		}
+		if err := p.Trigger(); err != nil {
+			t.Fatalf("Trigger: %v", err)
+		}
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	found := map[string]bool{}
+	for _, f := range families {
+		if f.GetName() != "alien_probe_count" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			var pairs []string
+			for _, l := range m.GetLabel() {
+				pairs = append(pairs, l.GetName()+"="+l.GetValue())
+			}
+			found[strings.Join(pairs, ",")] = true
+		}
+	}
+
+	for _, want := range []string{
+		"endpoint=" + srv.URL + ",success=true,team=metrics-a",
+		"endpoint=" + srv.URL + ",env=prod,success=true,team=metrics-b",
+	} {
+		if !found[want] {
+			t.Errorf("missing series %s in %v", want, found)
+		}
+	}
+}
@@ -0,0 +1,465 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMailTimeout is how long a mail check may take when the
+// probe has no timeout set with WithClient
+const defaultMailTimeout = 10 * time.Second
+
+// defaultMailHello is the name sent with EHLO when none is given
+const defaultMailHello = "localhost"
+
+// mailConn is a connection to a mail server, which records every
+// line received in the Body of a Result
+type mailConn struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	res    *Result
+	config *tls.Config
+}
+
+// dialMail connects to the mail server at the endpoint, where the
+// scheme is either the protocol, connecting on the plain port, or
+// the protocol with an s suffix, connecting with TLS straight away
+func (p *Probe) dialMail(ctx context.Context, res *Result, scheme string, port string, tlsPort string) (*mailConn, error) {
+	endpoint, _, _, err := p.renderRequest()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	implicitTLS := false
+	switch u.Scheme {
+	case scheme:
+	case scheme + "s":
+		implicitTLS = true
+		port = tlsPort
+	default:
+		return nil, fmt.Errorf("%w: endpoint scheme must be %s or %ss", ErrMail, scheme, scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	conn, err := p.dial(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c := &mailConn{conn: conn, r: bufio.NewReader(conn), res: res, config: p.tlsConfig(u.Hostname())}
+	if implicitTLS {
+		if err := c.startTLS(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// mailTimeout returns the context for a mail check, which is limited
+// by the probe's timeout
+func (p *Probe) mailTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := p.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultMailTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// startTLS performs a TLS handshake over the connection, recording
+// the connection state on the Result
+func (c *mailConn) startTLS() error {
+	// Anything already sent by the server could have been injected
+	// before the connection was secured
+	if c.r.Buffered() > 0 {
+		return fmt.Errorf("%w: data received before TLS handshake", ErrMail)
+	}
+	tc := tls.Client(c.conn, c.config)
+	if err := tc.Handshake(); err != nil {
+		return fmt.Errorf("%w: TLS handshake: %v", ErrMail, err)
+	}
+	state := tc.ConnectionState()
+	c.res.TLS = &state
+	c.conn = tc
+	c.r = bufio.NewReader(tc)
+	return nil
+}
+
+// readLine reads a line, without its line ending
+func (c *mailConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMail, err)
+	}
+	if len(c.res.Body)+len(line) <= maxBodySize {
+		c.res.Body += line
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// command sends a command line
+func (c *mailConn) command(cmd string) error {
+	if _, err := fmt.Fprintf(c.conn, "%s\r\n", cmd); err != nil {
+		return fmt.Errorf("%w: %v", ErrMail, err)
+	}
+	return nil
+}
+
+// Close closes the connection
+func (c *mailConn) Close() error {
+	return c.conn.Close()
+}
+
+// smtpReply reads a reply, which may span several lines, returning
+// its code and the text of each line
+func (c *mailConn) smtpReply() (int, []string, error) {
+	var lines []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(line) < 3 {
+			return 0, nil, fmt.Errorf("%w: invalid reply %q", ErrMail, line)
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil || len(line) > 3 && line[3] != ' ' && line[3] != '-' {
+			return 0, nil, fmt.Errorf("%w: invalid reply %q", ErrMail, line)
+		}
+		if len(line) > 4 {
+			lines = append(lines, line[4:])
+		} else {
+			lines = append(lines, "")
+		}
+		if len(line) == 3 || line[3] == ' ' {
+			return code, lines, nil
+		}
+	}
+}
+
+// smtpCommand sends a command and reads its reply, which must have
+// the code
+func (c *mailConn) smtpCommand(cmd string, want int) ([]string, error) {
+	if err := c.command(cmd); err != nil {
+		return nil, err
+	}
+	code, lines, err := c.smtpReply()
+	if err != nil {
+		return nil, err
+	}
+	if code != want {
+		return nil, fmt.Errorf("%w: %s replied %d %s", ErrMail, strings.Fields(cmd)[0], code, strings.Join(lines, " "))
+	}
+	return lines, nil
+}
+
+// doSMTP reads the greeting of a SMTP server, then introduces itself
+// with EHLO, recording the extensions offered, and upgrades to TLS
+// if required
+func (p *Probe) doSMTP(ctx context.Context, res *Result) error {
+	ctx, cancel := p.mailTimeout(ctx)
+	defer cancel()
+	c, err := p.dialMail(ctx, res, "smtp", "25", "465")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	code, lines, err := c.smtpReply()
+	if err != nil {
+		return err
+	}
+	res.Code = code
+	if code != 220 {
+		return fmt.Errorf("%w: greeting %d %s", ErrMail, code, strings.Join(lines, " "))
+	}
+
+	// The first line of the reply to EHLO is the server's name, and
+	// each line after it an extension
+	ehlo := func() error {
+		lines, err := c.smtpCommand("EHLO "+p.mailHello, 250)
+		if err != nil {
+			return err
+		}
+		res.Capabilities = lines[1:]
+		return nil
+	}
+	if err := ehlo(); err != nil {
+		return err
+	}
+
+	if p.startTLS {
+		if !hasCapability(res.Capabilities, "STARTTLS") {
+			return fmt.Errorf("%w: STARTTLS not offered", ErrMail)
+		}
+		if _, err := c.smtpCommand("STARTTLS", 220); err != nil {
+			return err
+		}
+		if err := c.startTLS(); err != nil {
+			return err
+		}
+		if err := ehlo(); err != nil {
+			return err
+		}
+	}
+
+	c.smtpCommand("QUIT", 221)
+	return nil
+}
+
+// imapCommand sends a tagged command and reads the untagged lines
+// received until its completion, which must be OK
+func (c *mailConn) imapCommand(tag string, cmd string) ([]string, error) {
+	if err := c.command(tag + " " + cmd); err != nil {
+		return nil, err
+	}
+	var untagged []string
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, tag+" ") {
+			untagged = append(untagged, line)
+			continue
+		}
+		if status := strings.TrimPrefix(line, tag+" "); !strings.HasPrefix(status, "OK") {
+			return nil, fmt.Errorf("%w: %s replied %s", ErrMail, cmd, status)
+		}
+		return untagged, nil
+	}
+}
+
+// doIMAP reads the greeting of an IMAP server, then asks for its
+// capabilities, and upgrades to TLS if required
+func (p *Probe) doIMAP(ctx context.Context, res *Result) error {
+	ctx, cancel := p.mailTimeout(ctx)
+	defer cancel()
+	c, err := p.dialMail(ctx, res, "imap", "143", "993")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	greeting, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		return fmt.Errorf("%w: greeting %s", ErrMail, greeting)
+	}
+
+	capability := func(tag string) error {
+		untagged, err := c.imapCommand(tag, "CAPABILITY")
+		if err != nil {
+			return err
+		}
+		res.Capabilities = nil
+		for _, line := range untagged {
+			if fields := strings.Fields(line); len(fields) > 1 && strings.EqualFold(fields[1], "CAPABILITY") {
+				res.Capabilities = append(res.Capabilities, fields[2:]...)
+			}
+		}
+		return nil
+	}
+	if err := capability("a1"); err != nil {
+		return err
+	}
+
+	if p.startTLS {
+		if !hasCapability(res.Capabilities, "STARTTLS") {
+			return fmt.Errorf("%w: STARTTLS not offered", ErrMail)
+		}
+		if _, err := c.imapCommand("a2", "STARTTLS"); err != nil {
+			return err
+		}
+		if err := c.startTLS(); err != nil {
+			return err
+		}
+		if err := capability("a3"); err != nil {
+			return err
+		}
+	}
+
+	c.imapCommand("a4", "LOGOUT")
+	return nil
+}
+
+// pop3Command sends a command and reads its status line, which must
+// be +OK
+func (c *mailConn) pop3Command(cmd string) error {
+	if err := c.command(cmd); err != nil {
+		return err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("%w: %s replied %s", ErrMail, cmd, line)
+	}
+	return nil
+}
+
+// doPOP3 reads the greeting of a POP3 server, then asks for its
+// capabilities, and upgrades to TLS if required
+func (p *Probe) doPOP3(ctx context.Context, res *Result) error {
+	ctx, cancel := p.mailTimeout(ctx)
+	defer cancel()
+	c, err := p.dialMail(ctx, res, "pop3", "110", "995")
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	greeting, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("%w: greeting %s", ErrMail, greeting)
+	}
+
+	// The capabilities follow on one line each, ending with a line
+	// holding only a full stop
+	capa := func() error {
+		if err := c.pop3Command("CAPA"); err != nil {
+			return err
+		}
+		res.Capabilities = nil
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return err
+			}
+			if line == "." {
+				return nil
+			}
+			res.Capabilities = append(res.Capabilities, line)
+		}
+	}
+	if err := capa(); err != nil {
+		return err
+	}
+
+	if p.startTLS {
+		if !hasCapability(res.Capabilities, "STLS") {
+			return fmt.Errorf("%w: STLS not offered", ErrMail)
+		}
+		if err := c.pop3Command("STLS"); err != nil {
+			return err
+		}
+		if err := c.startTLS(); err != nil {
+			return err
+		}
+		if err := capa(); err != nil {
+			return err
+		}
+	}
+
+	c.pop3Command("QUIT")
+	return nil
+}
+
+// hasCapability reports whether any of the capabilities, ignoring
+// any parameters after the name, is the named capability
+func hasCapability(capabilities []string, name string) bool {
+	for _, c := range capabilities {
+		if fields := strings.Fields(c); len(fields) > 0 && strings.EqualFold(fields[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithSMTP makes the probe check a SMTP server at the endpoint, which
+// is smtp://host:port, or smtps://host:port for TLS from the start.
+// The probe reads the greeting, sends EHLO with the hello name, or
+// localhost if empty, and then QUIT, recording the extensions offered
+// as the Capabilities of the Result. The greeting's reply code is the
+// Code of the Result.
+//
+// Every line received is part of the Body of the Result, and an
+// unexpected reply is an ErrMail error.
+func WithSMTP(hello string) Option {
+	return func(p *Probe) error {
+		if hello == "" {
+			hello = defaultMailHello
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.mailHello = hello
+		p.kind = "SMTP"
+		p.checker = p.doSMTP
+		return nil
+	}
+}
+
+// WithIMAP makes the probe check an IMAP server at the endpoint,
+// which is imap://host:port, or imaps://host:port for TLS from the
+// start. The probe reads the greeting, sends CAPABILITY and then
+// LOGOUT, recording the capabilities as the Capabilities of the
+// Result.
+//
+// Every line received is part of the Body of the Result, and an
+// unexpected reply is an ErrMail error.
+func WithIMAP() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.kind = "IMAP"
+		p.checker = p.doIMAP
+		return nil
+	}
+}
+
+// WithPOP3 makes the probe check a POP3 server at the endpoint, which
+// is pop3://host:port, or pop3s://host:port for TLS from the start.
+// The probe reads the greeting, sends CAPA and then QUIT, recording
+// the capabilities as the Capabilities of the Result.
+//
+// Every line received is part of the Body of the Result, and an
+// unexpected reply is an ErrMail error.
+func WithPOP3() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.kind = "POP3"
+		p.checker = p.doPOP3
+		return nil
+	}
+}
+
+// WithStartTLS makes a SMTP, IMAP or POP3 probe upgrade the
+// connection to TLS with STARTTLS, or STLS for POP3, once the server
+// has listed its capabilities, which are then listed again. The TLS
+// connection state, including the server's certificates, is recorded
+// as the TLS of the Result. A server which does not offer STARTTLS is
+// an ErrMail error.
+//
+// The options such as WithTLSCA which configure TLS for HTTP probes
+// apply to the upgraded connection.
+func WithStartTLS() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.startTLS = true
+		return nil
+	}
+}
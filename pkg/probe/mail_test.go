@@ -0,0 +1,217 @@
+package probe_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// mailScript returns the reply to a command line received by a fake
+// mail server, and whether to then upgrade the connection to TLS
+type mailScript func(line string, secure bool) (reply string, upgrade bool)
+
+// mailServer serves the script, sending the greeting to each client,
+// over TLS from the start when implicit is set
+func mailServer(t *testing.T, pki *testPKI, implicit bool, greeting string, script mailScript) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{pki.server}}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		secure := implicit
+		if implicit {
+			conn = tls.Server(conn, config)
+		}
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, greeting)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			reply, upgrade := script(strings.TrimSpace(line), secure)
+			io.WriteString(conn, reply)
+			if upgrade {
+				conn = tls.Server(conn, config)
+				r = bufio.NewReader(conn)
+				secure = true
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln
+}
+
+func smtpScript(line string, secure bool) (string, bool) {
+	switch {
+	case strings.HasPrefix(line, "EHLO ") && secure:
+		return "250-mail.test greets " + line[5:] + "\r\n250 AUTH PLAIN LOGIN\r\n", false
+	case strings.HasPrefix(line, "EHLO "):
+		return "250-mail.test greets " + line[5:] + "\r\n250-SIZE 1024\r\n250 STARTTLS\r\n", false
+	case line == "STARTTLS":
+		return "220 ready\r\n", true
+	case line == "QUIT":
+		return "221 bye\r\n", false
+	}
+	return "500 unknown command\r\n", false
+}
+
+func imapScript(line string, secure bool) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return "* BAD\r\n", false
+	}
+	tag := fields[0]
+	switch fields[1] {
+	case "CAPABILITY":
+		if secure {
+			return "* CAPABILITY IMAP4rev1 AUTH=PLAIN\r\n" + tag + " OK done\r\n", false
+		}
+		return "* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED\r\n" + tag + " OK done\r\n", false
+	case "STARTTLS":
+		return tag + " OK begin TLS\r\n", true
+	case "LOGOUT":
+		return "* BYE\r\n" + tag + " OK done\r\n", false
+	}
+	return tag + " BAD unknown command\r\n", false
+}
+
+func pop3Script(line string, secure bool) (string, bool) {
+	switch line {
+	case "CAPA":
+		if secure {
+			return "+OK\r\nUSER\r\nSASL PLAIN\r\n.\r\n", false
+		}
+		return "+OK\r\nUSER\r\nSTLS\r\n.\r\n", false
+	case "STLS":
+		return "+OK begin TLS\r\n", true
+	case "QUIT":
+		return "+OK bye\r\n", false
+	}
+	return "-ERR unknown command\r\n", false
+}
+
+func TestMail(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+
+	smtp := mailServer(t, pki, false, "220 mail.test ESMTP\r\n", smtpScript)
+	defer smtp.Close()
+	smtps := mailServer(t, pki, true, "220 mail.test ESMTP\r\n", smtpScript)
+	defer smtps.Close()
+	refused := mailServer(t, pki, false, "554 no service\r\n", smtpScript)
+	defer refused.Close()
+	short := mailServer(t, pki, false, "22\r\n", smtpScript)
+	defer short.Close()
+	imap := mailServer(t, pki, false, "* OK IMAP ready\r\n", imapScript)
+	defer imap.Close()
+	pop3 := mailServer(t, pki, false, "+OK POP3 ready\r\n", pop3Script)
+	defer pop3.Close()
+
+	var mailSets = []struct {
+		name     string
+		endpoint string
+		protocol probe.Option
+		startTLS bool
+		filter   probe.ResultFilter
+		tls      bool
+		mailErr  bool
+	}{
+		{name: "smtp", endpoint: "smtp://" + smtp.Addr().String(), protocol: probe.WithSMTP("probe.test"), filter: probe.FilterCapability("STARTTLS")},
+		{name: "smtp starttls", endpoint: "smtp://" + smtp.Addr().String(), protocol: probe.WithSMTP(""), startTLS: true, filter: probe.FilterCapability("AUTH"), tls: true},
+		{name: "smtps", endpoint: "smtps://" + smtps.Addr().String(), protocol: probe.WithSMTP(""), filter: probe.FilterResponseCode(220), tls: true},
+		{name: "smtp refused", endpoint: "smtp://" + refused.Addr().String(), protocol: probe.WithSMTP(""), filter: probe.FilterResponseCode(220), mailErr: true},
+		{name: "smtp short reply", endpoint: "smtp://" + short.Addr().String(), protocol: probe.WithSMTP(""), filter: probe.FilterResponseCode(220), mailErr: true},
+		{name: "smtp wrong scheme", endpoint: "imap://" + smtp.Addr().String(), protocol: probe.WithSMTP(""), filter: probe.FilterResponseCode(220), mailErr: true},
+		{name: "imap", endpoint: "imap://" + imap.Addr().String(), protocol: probe.WithIMAP(), filter: probe.FilterCapability("LOGINDISABLED")},
+		{name: "imap starttls", endpoint: "imap://" + imap.Addr().String(), protocol: probe.WithIMAP(), startTLS: true, filter: probe.FilterCapability("AUTH=PLAIN"), tls: true},
+		{name: "pop3", endpoint: "pop3://" + pop3.Addr().String(), protocol: probe.WithPOP3(), filter: probe.FilterCapability("STLS")},
+		{name: "pop3 stls", endpoint: "pop3://" + pop3.Addr().String(), protocol: probe.WithPOP3(), startTLS: true, filter: probe.FilterCapability("SASL"), tls: true},
+		{name: "starttls not offered", endpoint: "smtps://" + smtps.Addr().String(), protocol: probe.WithSMTP(""), startTLS: true, filter: probe.FilterResponseCode(220), mailErr: true},
+	}
+
+	for _, ms := range mailSets {
+		options := []probe.Option{
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			ms.protocol,
+			probe.WithTLSCA(pki.caFile),
+			probe.WithTLSServerName("probe.test"),
+			probe.WithClient(time.Second),
+			probe.WithSuccessFilter(ms.filter),
+		}
+		if ms.startTLS {
+			options = append(options, probe.WithStartTLS())
+		}
+		p, err := probe.New(ms.endpoint, options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", ms.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", ms.name, err)
+		}
+		if ms.mailErr {
+			if !errors.Is(res.Error, probe.ErrMail) {
+				t.Errorf("%s: want mail error, got %v", ms.name, res.Error)
+			}
+			continue
+		}
+		if res.Error != nil || !res.Success {
+			t.Errorf("%s: want success, got %t %v (%q)", ms.name, res.Success, res.Error, res.Body)
+			continue
+		}
+		if ms.tls && (res.TLS == nil || res.TLS.PeerCertificates[0].Subject.CommonName != "probe.test") {
+			t.Errorf("%s: want server certificate recorded, got %v", ms.name, res.TLS)
+		}
+		if !ms.tls && res.TLS != nil {
+			t.Errorf("%s: want no TLS, got %v", ms.name, res.TLS)
+		}
+	}
+}
+
+func TestSMTPHello(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+	smtp := mailServer(t, pki, false, "220 mail.test ESMTP\r\n", smtpScript)
+	defer smtp.Close()
+
+	p, err := probe.New("smtp://"+smtp.Addr().String(),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithSMTP("probe.test"),
+		probe.WithSuccessFilter(probe.FilterResponseContains("greets probe.test")),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	res, err := p.Check(context.Background())
+	if err != nil || res.Error != nil || !res.Success {
+		t.Errorf("want EHLO name in body, got %v %v (%q)", err, res.Error, res.Body)
+	}
+	if res.Code != 220 || len(res.Capabilities) != 2 {
+		t.Errorf("want greeting code and capabilities, got %d %q", res.Code, res.Capabilities)
+	}
+}
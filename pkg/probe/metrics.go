@@ -0,0 +1,234 @@
+package probe
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// perfdataSeries is the label and unit of a performance data series
+type perfdataSeries struct {
+	label string
+	unit  string
+}
+
+// metricSet holds the metrics shared by probes with the same labels
+type metricSet struct {
+	count        *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	stepCount    *prometheus.CounterVec
+	stepDuration *prometheus.HistogramVec
+	addrCount    *prometheus.CounterVec
+	addrDuration *prometheus.HistogramVec
+	pingRTT      *prometheus.HistogramVec
+	pingLoss     *prometheus.HistogramVec
+	perfdata     *prometheus.GaugeVec
+
+	// processing guards perfdataSeries, the performance data series
+	// last set for each endpoint
+	processing     sync.Mutex
+	perfdataSeries map[string]map[perfdataSeries]bool
+}
+
+// newMetricSet creates the metrics for probes with the given labels,
+// which are added to every series as constant labels
+func newMetricSet(labels map[string]string) *metricSet {
+	return &metricSet{
+		count: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "alien_probe_count",
+			Help:        "Count of probes by endpoint and success",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+			"success",
+		}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "alien_probe_duration_seconds",
+			Help:        "Duration of probe checks by endpoint",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+		}),
+		stepCount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "alien_probe_step_count",
+			Help:        "Count of probe steps run by endpoint, step and success",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+			"step",
+			"success",
+		}),
+		stepDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "alien_probe_step_duration_seconds",
+			Help:        "Duration of probe steps by endpoint and step",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+			"step",
+		}),
+		addrCount: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "alien_probe_address_count",
+			Help:        "Count of probe checks of each address by endpoint, address and success",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+			"address",
+			"success",
+		}),
+		addrDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "alien_probe_address_duration_seconds",
+			Help:        "Duration of probe checks of each address by endpoint and address",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+			"address",
+		}),
+		pingRTT: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "alien_probe_ping_rtt_seconds",
+			Help:        "Round trip time of ping replies by endpoint",
+			Buckets:     []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+		}),
+		pingLoss: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "alien_probe_ping_packet_loss_ratio",
+			Help:        "Ratio of ping requests unanswered in each check by endpoint",
+			Buckets:     []float64{0, .01, .05, .1, .25, .5, .75, 1},
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+		}),
+		perfdata: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        "alien_probe_perfdata",
+			Help:        "Latest performance data output by a command by endpoint, label and unit",
+			ConstLabels: labels,
+		}, []string{
+			"endpoint",
+			"label",
+			"unit",
+		}),
+		perfdataSeries: make(map[string]map[perfdataSeries]bool),
+	}
+}
+
+// record updates the metrics with the outcome of a check, where
+// errors are recorded as success=false
+func (m *metricSet) record(res *Result) {
+	endpoint := res.Probe.Endpoint()
+	m.count.WithLabelValues(endpoint, strconv.FormatBool(res.Success)).Inc()
+	m.duration.WithLabelValues(endpoint).Observe(res.Latency.Seconds())
+
+	for _, sr := range res.Steps {
+		m.stepCount.WithLabelValues(endpoint, sr.Step, strconv.FormatBool(sr.Success)).Inc()
+		m.stepDuration.WithLabelValues(endpoint, sr.Step).Observe(sr.Latency.Seconds())
+	}
+
+	for _, ar := range res.Addresses {
+		m.addrCount.WithLabelValues(endpoint, ar.Address, strconv.FormatBool(ar.Success)).Inc()
+		m.addrDuration.WithLabelValues(endpoint, ar.Address).Observe(ar.Latency.Seconds())
+	}
+
+	if res.PacketsSent > 0 {
+		m.pingLoss.WithLabelValues(endpoint).Observe(res.PacketLoss / 100)
+		for _, rtt := range res.RTTs {
+			m.pingRTT.WithLabelValues(endpoint).Observe(rtt.Seconds())
+		}
+	}
+
+	m.recordPerfdata(endpoint, res.Perfdata)
+}
+
+// recordPerfdata sets the performance data series of the endpoint,
+// removing those which the latest check did not output
+func (m *metricSet) recordPerfdata(endpoint string, perfdata []Perfdata) {
+	m.processing.Lock()
+	defer m.processing.Unlock()
+
+	series := make(map[perfdataSeries]bool, len(perfdata))
+	for _, pd := range perfdata {
+		gauge, err := m.perfdata.GetMetricWithLabelValues(endpoint, pd.Label, pd.Unit)
+		if err != nil {
+			continue
+		}
+		gauge.Set(pd.Value)
+		series[perfdataSeries{label: pd.Label, unit: pd.Unit}] = true
+	}
+	for ps := range m.perfdataSeries[endpoint] {
+		if !series[ps] {
+			m.perfdata.DeleteLabelValues(endpoint, ps.label, ps.unit)
+		}
+	}
+	if len(series) > 0 {
+		m.perfdataSeries[endpoint] = series
+	} else {
+		delete(m.perfdataSeries, endpoint)
+	}
+}
+
+// collect sends every metric in the set on the channel
+func (m *metricSet) collect(ch chan<- prometheus.Metric) {
+	m.count.Collect(ch)
+	m.duration.Collect(ch)
+	m.stepCount.Collect(ch)
+	m.stepDuration.Collect(ch)
+	m.addrCount.Collect(ch)
+	m.addrDuration.Collect(ch)
+	m.pingRTT.Collect(ch)
+	m.pingLoss.Collect(ch)
+	m.perfdata.Collect(ch)
+}
+
+// collector emits the metrics of every probe. It describes no
+// metrics up front, which registers it as an unchecked collector
+// so that probes can each have a different set of labels.
+type collector struct {
+	processing sync.Mutex
+	sets       map[string]*metricSet
+}
+
+// metrics is the collector for all probes in the process
+var metrics = &collector{
+	sets: make(map[string]*metricSet),
+}
+
+// registerMetrics makes sure metrics is only registered once
+var registerMetrics sync.Once
+
+// forLabels returns the metricSet for the labels, creating it if
+// this is the first probe to use them
+func (c *collector) forLabels(labels map[string]string) (*metricSet, error) {
+	var err error
+	registerMetrics.Do(func() {
+		err = prometheus.Register(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.processing.Lock()
+	defer c.processing.Unlock()
+
+	key := labelString(labels)
+	if m, ok := c.sets[key]; ok {
+		return m, nil
+	}
+	m := newMetricSet(labels)
+	c.sets[key] = m
+	return m, nil
+}
+
+// Describe implements prometheus.Collector, and intentionally
+// sends nothing
+func (c *collector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.processing.Lock()
+	defer c.processing.Unlock()
+
+	for _, m := range c.sets {
+		m.collect(ch)
+	}
+}
@@ -0,0 +1,174 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxTokenRefreshMargin is the most time before a token expires
+// that it is refreshed
+const maxTokenRefreshMargin = time.Minute
+
+// tokenSource obtains OAuth2 access tokens with the client
+// credentials grant, caching each token until it is due to be
+// refreshed shortly before it expires
+type tokenSource struct {
+	mu sync.Mutex
+
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	// authorization is the Authorization header value for the
+	// cached token, with expires when it stops being valid and
+	// refresh when a new token is obtained. Zero times mean the
+	// token does not expire.
+	authorization string
+	expires       time.Time
+	refresh       time.Time
+}
+
+// tokenResponse is a token endpoint response, see RFC 6749 5.1 and 5.2
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// authorize sets the Authorization header of the request, obtaining
+// a new token with the client if there is no cached token or it is
+// due to be refreshed. A cached token which has not expired is still
+// used if a refresh fails. The client secret template may use env
+// and secret if secrets is set.
+func (ts *tokenSource) authorize(ctx context.Context, client *http.Client, req *http.Request, secrets bool) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	now := time.Now()
+	if ts.authorization == "" || (!ts.refresh.IsZero() && now.After(ts.refresh)) {
+		err := ts.fetch(ctx, client, secrets)
+		if err != nil && (ts.authorization == "" || (!ts.expires.IsZero() && now.After(ts.expires))) {
+			ts.authorization = ""
+			return fmt.Errorf("%w: %v", ErrToken, err)
+		}
+	}
+
+	req.Header.Set("Authorization", ts.authorization)
+	return nil
+}
+
+// invalidate drops the cached token, so that the next request
+// obtains a new one
+func (ts *tokenSource) invalidate() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.authorization = ""
+}
+
+// fetch obtains a new token from the token endpoint
+func (ts *tokenSource) fetch(ctx context.Context, client *http.Client, secrets bool) error {
+	secret, err := render(ts.clientSecret, nil, secrets)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(ts.scopes) > 0 {
+		form.Set("scope", strings.Join(ts.scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(ts.clientID), url.QueryEscape(secret))
+
+	req, _ = traceProxy(req)
+	obtained := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return fmt.Errorf("token endpoint responded %s: %v", resp.Status, err)
+	}
+	if tr.Error != "" {
+		if tr.ErrorDescription != "" {
+			return fmt.Errorf("token endpoint responded %s: %s", tr.Error, tr.ErrorDescription)
+		}
+		return fmt.Errorf("token endpoint responded %s", tr.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token endpoint responded %s", resp.Status)
+	}
+	if tr.AccessToken == "" {
+		return fmt.Errorf("token endpoint responded without an access token")
+	}
+
+	tokenType := tr.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	ts.authorization = tokenType + " " + tr.AccessToken
+
+	ts.expires, ts.refresh = time.Time{}, time.Time{}
+	if tr.ExpiresIn > 0 {
+		lifetime := time.Duration(tr.ExpiresIn) * time.Second
+		margin := lifetime / 5
+		if margin > maxTokenRefreshMargin {
+			margin = maxTokenRefreshMargin
+		}
+		ts.expires = obtained.Add(lifetime)
+		ts.refresh = ts.expires.Add(-margin)
+	}
+	return nil
+}
+
+// WithOAuth2ClientCredentials authorises requests with a bearer token
+// obtained from the token URL with the OAuth2 client credentials
+// grant. Tokens are cached and refreshed shortly before they expire,
+// or after the endpoint responds 401 Unauthorized. The client secret
+// is a request template, so in a probe made with WithTemplateSecrets
+// may be read from a file with {{secret "/run/secrets/client"}}.
+//
+// Failing to obtain a token is reported as an ErrToken error on the
+// Result, and the endpoint is not requested.
+func WithOAuth2ClientCredentials(tokenURL string, clientID string, clientSecret string, scopes ...string) Option {
+	return func(p *Probe) error {
+		u, err := url.Parse(tokenURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%v: token URL %q", ErrInvalidOAuth2, tokenURL)
+		}
+		if clientID == "" {
+			return fmt.Errorf("%v: no client ID", ErrInvalidOAuth2)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.tokens = &tokenSource{
+			tokenURL:     tokenURL,
+			clientID:     clientID,
+			clientSecret: clientSecret,
+			scopes:       scopes,
+		}
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// newTokenServer starts a token endpoint issuing numbered tokens with
+// the lifetime to the client, and an API accepting the latest token
+func newTokenServer(t *testing.T, lifetime int) (tokens *httptest.Server, api *httptest.Server, issued *int32) {
+	issued = new(int32)
+	tokens = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.PostFormValue("grant_type") != "client_credentials" || id != "alien" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+		n := atomic.AddInt32(issued, 1)
+		fmt.Fprintf(w, `{"access_token": "token%d", "token_type": "bearer", "expires_in": %d}`, n, lifetime)
+	}))
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", atomic.LoadInt32(issued)) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	return tokens, api, issued
+}
+
+func TestOAuth2(t *testing.T) {
+	tokens, api, issued := newTokenServer(t, 1)
+	defer tokens.Close()
+	defer api.Close()
+
+	p, err := probe.New(api.URL,
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithOAuth2ClientCredentials(tokens.URL, "alien", "s3cret", "probe"),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	check := func(stage string, want int32) {
+		res, err := p.Check(context.Background())
+		if err != nil || res.Error != nil {
+			t.Fatalf("%s: Check: %v %v", stage, err, res.Error)
+		}
+		if !res.Success {
+			t.Errorf("%s: want success, got code %d", stage, res.Code)
+		}
+		if n := atomic.LoadInt32(issued); n != want {
+			t.Errorf("%s: want %d tokens issued, got %d", stage, want, n)
+		}
+	}
+
+	check("first", 1)
+	check("cached", 1)
+
+	// A one second token is refreshed a fifth of a second early
+	time.Sleep(900 * time.Millisecond)
+	check("refreshed", 2)
+
+	// A rejected token is replaced on the next check
+	atomic.AddInt32(issued, 1)
+	res, _ := p.Check(context.Background())
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("rejected: want 401, got %d", res.Code)
+	}
+	check("replaced", 4)
+}
+
+func TestOAuth2Failure(t *testing.T) {
+	tokens, api, issued := newTokenServer(t, 60)
+	defer tokens.Close()
+	defer api.Close()
+
+	p, err := probe.New(api.URL,
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithOAuth2ClientCredentials(tokens.URL, "alien", "wrong"),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	res, err := p.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if !errors.Is(res.Error, probe.ErrToken) {
+		t.Errorf("want token error, got %v", res.Error)
+	}
+	if res.Code != 0 || atomic.LoadInt32(issued) != 0 {
+		t.Errorf("want endpoint not requested, got code %d", res.Code)
+	}
+}
+
+func TestOAuth2Secrets(t *testing.T) {
+	tokens, api, _ := newTokenServer(t, 60)
+	defer tokens.Close()
+	defer api.Close()
+	t.Setenv("ALIEN_TEST_CLIENT_SECRET", "s3cret")
+
+	// The client secret may only read the environment when allowed
+	for _, secrets := range []bool{false, true} {
+		options := []probe.Option{
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithOAuth2ClientCredentials(tokens.URL, "alien", `{{env "ALIEN_TEST_CLIENT_SECRET"}}`),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		}
+		if secrets {
+			options = append(options, probe.WithTemplateSecrets())
+		}
+		p, err := probe.New(api.URL, options...)
+		if err != nil {
+			t.Fatalf("%t: New probe: %v", secrets, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if !secrets {
+			if err == nil {
+				t.Errorf("want error without template secrets, got %+v", res)
+			}
+			continue
+		}
+		if err != nil || res.Error != nil || !res.Success {
+			t.Errorf("want success with template secrets, got %v %+v", err, res)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package probe
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -23,10 +26,13 @@ func WithAuthBasic(user string, pass string) Option {
 }
 
 // WithHeader sets the given header to the given value for
-// the probe
+// the probe. The value may be a request template.
 func WithHeader(header string, value string) Option {
 	return func(p *Probe) error {
-		return errors.New("not implemented") // TODO: implement
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.headers.Set(header, value)
+		return nil
 	}
 }
 
@@ -38,7 +44,6 @@ func WithFrequency(frequency time.Duration) Option {
 		p.processing.Lock()
 		defer p.processing.Unlock()
 		p.Stop()
-		p.ticker = time.NewTicker(frequency)
 		p.freq = frequency
 		return nil
 	}
@@ -52,6 +57,26 @@ func WithLogger(l logrus.StdLogger) Option {
 	}
 }
 
+// WithLabels adds labels to the probe, which are added to all
+// of its metrics and made available to notifications.
+//
+// Label names and values must follow the Prometheus label rules.
+func WithLabels(labels map[string]string) Option {
+	return func(p *Probe) error {
+		for k, v := range labels {
+			if err := ValidateLabel(k, v); err != nil {
+				return err
+			}
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		for k, v := range labels {
+			p.labels[k] = v
+		}
+		return nil
+	}
+}
+
 // WithMethod sets the probe's HTTP method
 func WithMethod(method string) Option {
 	return func(p *Probe) error {
@@ -62,19 +87,53 @@ func WithMethod(method string) Option {
 	}
 }
 
-// WithPayload sets a body to send in a request
+// WithPayload sets a body to send in a request, which may be a
+// request template, such as:
+//
+//	{"key": "{{uuid}}", "since": {{(ago "1h").Unix}}}
+//
+// The functions now, ago, uuid, randInt and randString are
+// available, along with env and secret for probes made with
+// WithTemplateSecrets. Templates are evaluated on every check, as is
+// the probe endpoint unless WithLiteralEndpoint is used.
 func WithPayload(payload string) Option {
 	return func(p *Probe) error {
 		p.processing.Lock()
 		defer p.processing.Unlock()
 		p.payload = payload
+		p.payloadHex = false
 		return nil
 	}
 }
 
-// WithClient sets the outgoing request HTTP client
+// WithHexPayload sets the payload of the probe as hexadecimal, for
+// binary protocols such as those spoken over UDP. The payload may be
+// a template, and spaces and newlines between bytes are ignored, so
+// that "de ad be ef" is sent as four bytes.
+func WithHexPayload(payload string) Option {
+	return func(p *Probe) error {
+		if !strings.Contains(payload, "{{") {
+			if _, err := decodeHex(payload); err != nil {
+				return fmt.Errorf("%v: %v", ErrInvalidPayload, err)
+			}
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.payload = payload
+		p.payloadHex = true
+		return nil
+	}
+}
+
+// decodeHex decodes hexadecimal text, ignoring whitespace
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(s), ""))
+}
+
+// WithClient sets the timeout of the probe's HTTP client, which
+// covers the whole request including reading the response
 //
-// If not used, the http.DefaultClient is used
+// If not used, there is no timeout
 func WithClient(timeout time.Duration) Option {
 	return func(p *Probe) error {
 		p.processing.Lock()
@@ -2,34 +2,73 @@ package probe
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
+// maxBodySize is the most of a response body which will be
+// read into a Result
+const maxBodySize = 1 << 20
+
 // Probe is an abstraction for a set of basic procedures
 // to carry out to check an endpoint, and to manage the
 // conditions which indicate a successful probe.
 type Probe struct {
+	lastCheck int64 // unix nanoseconds, accessed atomically so kept 64-bit aligned
+
 	init       bool
 	processing sync.Mutex
-	running    bool
-
-	client *http.Client
-	prom   *prometheus.CounterVec
-
-	endpoint string
-	method   string
-	payload  string
-	freq     time.Duration
-	ticker   *time.Ticker
-	success  ResultFilter
+	running    atomic.Bool
+
+	client    *http.Client
+	transport *http.Transport
+	dialer    *net.Dialer
+	proxy     func(*http.Request) (*url.URL, error)
+	hosts     map[string]string
+	tokens    *tokenSource
+	network   string
+	fresh     bool
+	metrics   *metricSet
+
+	redirectLimit    int
+	redirectSameHost bool
+
+	eachAddress bool
+
+	kind            string
+	checker         func(context.Context, *Result) error
+	endpoint        string
+	labels          map[string]string
+	method          string
+	headers         http.Header
+	payload         string
+	payloadHex      bool
+	literalEndpoint bool
+	templateSecrets bool
+	steps           []Step
+	grpcService     string
+	pingCount       int
+	pingInterval    time.Duration
+	mailHello       string
+	startTLS        bool
+	execArgs        []string
+	execEnv         []string
+	freq            time.Duration
+	ticker          *time.Ticker
+	success         ResultFilter
 
 	failureActions []Action
 	successActions []Action
@@ -46,15 +85,25 @@ func New(endpoint string, options ...Option) (*Probe, error) {
 	// Generate default struct values
 	p := &Probe{
 		init:     true,
-		client:   http.DefaultClient,
 		endpoint: endpoint,
+		labels:   make(map[string]string),
 		method:   "GET",
+		headers:  make(http.Header),
 		payload:  "",
-		ticker:   time.NewTicker(10 * time.Second),
 		freq:     10 * time.Second,
 		stop:     make(chan time.Time),
+
+		proxy: http.ProxyFromEnvironment,
+
+		redirectLimit: defaultRedirectLimit,
 	}
 
+	p.transport = p.newTransport()
+	p.client = &http.Client{
+		Transport:     p.transport,
+		CheckRedirect: p.checkRedirect,
+	}
+	p.checker = p.doHTTP
 	p.logger = log.New(os.Stdout, fmt.Sprintf("%s: ", p), 0)
 
 	for _, o := range options {
@@ -63,14 +112,11 @@ func New(endpoint string, options ...Option) (*Probe, error) {
 		}
 	}
 
-	p.prom = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "alien_probe_count",
-		Help: "Count of probes by endpoint and success",
-	}, []string{
-		"endpoint",
-		"success",
-	})
-	prometheus.MustRegister(p.prom)
+	m, err := metrics.forLabels(p.labels)
+	if err != nil {
+		return nil, err
+	}
+	p.metrics = m
 
 	p.logger.Printf("%s: Registered prometheus metric collector", p)
 
@@ -87,17 +133,17 @@ func (p *Probe) Run() error {
 		return ErrNotInitialised
 	}
 
-	if p.running {
-		return ErrNotStopped
-	}
-
-	// Run the main loop in a new goroutine
 	if err := p.Validate(); err != nil {
 		return err
 	}
 
+	if !p.running.CompareAndSwap(false, true) {
+		return ErrNotStopped
+	}
+
+	// Run the main loop in a new goroutine
+	p.ticker = time.NewTicker(p.freq)
 	go p.run()
-	p.running = true
 
 	p.Trigger()
 
@@ -117,7 +163,7 @@ func (p *Probe) run() {
 		case <-p.stop:
 			// Cancellation has been requested
 			p.ticker.Stop()
-			p.running = false
+			p.running.Store(false)
 			p.logger.Printf("%s: Stopped", p)
 			return
 
@@ -145,7 +191,7 @@ func (p *Probe) Stop() error {
 
 	p.logger.Printf("%s: Stopping", p)
 
-	if !p.running {
+	if !p.running.Load() {
 		p.logger.Printf("%s: Already stopped", p)
 		return ErrNotRunning
 	}
@@ -154,9 +200,61 @@ func (p *Probe) Stop() error {
 	return nil
 }
 
+// Close closes the idle connections kept open by the probe for
+// reuse, which should be done once a probe made for one-off checks
+// is no longer needed
+func (p *Probe) Close() {
+	p.transport.CloseIdleConnections()
+}
+
+// Running reports whether the probe is scheduled
+func (p *Probe) Running() bool {
+	return p.running.Load()
+}
+
+// Frequency returns the rate at which checks are scheduled
+func (p *Probe) Frequency() time.Duration {
+	return p.freq
+}
+
+// LastChecked returns when the probe last completed a triggered
+// check, which is the zero time if it has not yet done so
+func (p *Probe) LastChecked() time.Time {
+	ns := atomic.LoadInt64(&p.lastCheck)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Endpoint returns the endpoint the probe checks, with any password
+// in it replaced by "xxxxx" so that it can be shown and exported
+func (p *Probe) Endpoint() string {
+	if !strings.Contains(p.endpoint, "@") {
+		return p.endpoint
+	}
+	u, err := url.Parse(p.endpoint)
+	if err != nil {
+		return p.endpoint
+	}
+	return u.Redacted()
+}
+
+// Kind returns the kind of check the probe makes, which is its
+// method for HTTP probes, and otherwise its type such as PING
+func (p *Probe) Kind() string {
+	if p.kind != "" {
+		return p.kind
+	}
+	return p.method
+}
+
 // String implements the Stringer interface
 func (p *Probe) String() string {
-	return fmt.Sprintf("Probe<%s '%s' every %s>", p.method, p.endpoint, p.freq)
+	if len(p.labels) > 0 {
+		return fmt.Sprintf("Probe<%s '%s' every %s %s>", p.Kind(), p.Endpoint(), p.freq, labelString(p.labels))
+	}
+	return fmt.Sprintf("Probe<%s '%s' every %s>", p.Kind(), p.Endpoint(), p.freq)
 }
 
 // Trigger a probe to do a check now
@@ -174,44 +272,193 @@ func (p *Probe) Trigger() error {
 
 	p.logger.Printf("%s: Triggered...", p)
 
-	body := bytes.NewBufferString(p.payload)
-	req, err := http.NewRequest(p.method, p.endpoint, body)
+	probeResult, success := p.check(context.Background())
+	atomic.StoreInt64(&p.lastCheck, time.Now().UnixNano())
+	if probeResult.Error != nil {
+		p.logger.Printf("%s: failed: %v", p, probeResult.Error)
+	} else {
+		p.logger.Printf("%s: Completed", p)
+	}
+
+	p.metrics.record(probeResult)
+
+	if success {
+		for _, a := range p.successActions {
+			a(*probeResult)
+		}
+	} else {
+		for _, a := range p.failureActions {
+			a(*probeResult)
+		}
+	}
+
+	return probeResult.Error
+}
+
+// Check carries out a single probe check and evaluates the success
+// filter, without recording metrics or running actions. Any error
+// making the check is set on the Result rather than returned.
+func (p *Probe) Check(ctx context.Context) (*Result, error) {
+	p.processing.Lock()
+	defer p.processing.Unlock()
+
+	if !p.init {
+		return nil, ErrNotInitialised
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	res, _ := p.check(ctx)
+	return res, nil
+}
+
+// check makes the request and evaluates the success filter
+func (p *Probe) check(ctx context.Context) (*Result, bool) {
+	if p.fresh {
+		p.transport.CloseIdleConnections()
+	}
+
+	res := &Result{
+		Timestamp: time.Now(),
+		Probe:     p,
+	}
+
+	checker := p.checker
+	if p.eachAddress {
+		checker = p.doAddresses
+	}
+
+	err := checker(ctx, res)
+	res.Latency = time.Since(res.Timestamp)
 	if err != nil {
-		p.logger.Printf("%s: failed: %v", p, err)
-		p.prom.WithLabelValues(p.endpoint, "false").Inc() // Record error as success=false
-		return err
+		res.Error = err
+		return res, false
 	}
-	res, err := p.client.Do(req)
+
+	res.Success = p.success.Check(res)
+	return res, res.Success
+}
+
+// doHTTP carries out the HTTP request for a probe check and
+// records the response on the given Result
+func (p *Probe) doHTTP(ctx context.Context, res *Result) error {
+	endpoint, headers, payload, err := p.renderRequest()
 	if err != nil {
-		p.logger.Printf("%s: failed: %v", p, err)
-		p.prom.WithLabelValues(p.endpoint, "false").Inc() // Record error as success=false
 		return err
 	}
 
-	probeResult := &Result{
-		Timestamp: time.Now(),
-		Probe:     p,
-		Code:      res.StatusCode,
-		Headers:   res.Header,
+	req, err := http.NewRequestWithContext(ctx, p.method, endpoint, bytes.NewBufferString(payload))
+	if err != nil {
+		return err
 	}
+	setHeaders(req, headers)
+	return p.roundTrip(req, res)
+}
 
-	p.logger.Printf("%s: Completed", p)
+// renderRequest evaluates the endpoint, header and payload templates
+func (p *Probe) renderRequest() (string, http.Header, string, error) {
+	vars := map[string]string{}
 
-	if p.success.Check(probeResult) {
-		p.prom.WithLabelValues(p.endpoint, "true").Inc()
-		for _, a := range p.successActions {
-			a(*probeResult)
+	endpoint := p.endpoint
+	if !p.literalEndpoint {
+		rendered, err := render(p.endpoint, vars, p.templateSecrets)
+		if err != nil {
+			return "", nil, "", err
 		}
-	} else {
-		p.prom.WithLabelValues(p.endpoint, "false").Inc()
-		for _, a := range p.failureActions {
-			a(*probeResult)
+		endpoint = rendered
+	}
+
+	payload, err := render(p.payload, vars, p.templateSecrets)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if p.payloadHex {
+		decoded, err := decodeHex(payload)
+		if err != nil {
+			return "", nil, "", fmt.Errorf("%v: %v", ErrInvalidPayload, err)
+		}
+		payload = string(decoded)
+	}
+
+	headers := make(http.Header, len(p.headers))
+	for k, values := range p.headers {
+		for _, v := range values {
+			value, err := render(v, vars, p.templateSecrets)
+			if err != nil {
+				return "", nil, "", err
+			}
+			headers.Add(k, value)
 		}
 	}
 
+	return endpoint, headers, payload, nil
+}
+
+// roundTrip sends the request and records the response on the
+// given Result
+func (p *Probe) roundTrip(req *http.Request, res *Result) error {
+	resp, err := p.send(p.client, req, res)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+
+	res.Code = resp.StatusCode
+	res.Headers = resp.Header
+	res.Trailers = resp.Trailer
+	res.Body = string(content)
+
 	return nil
 }
 
+// send sends the request with the client, authorised with an OAuth2
+// token if configured, and records the redirects followed and final
+// URL on the given Result. The caller must close the body of the
+// response.
+func (p *Probe) send(client *http.Client, req *http.Request, res *Result) (*http.Response, error) {
+	if p.tokens != nil {
+		if err := p.tokens.authorize(req.Context(), p.client, req, p.templateSecrets); err != nil {
+			return nil, err
+		}
+	}
+
+	req, trace := traceRedirects(req)
+	req, proxied := traceProxy(req)
+	resp, err := client.Do(req)
+	res.Redirects = trace.chain
+	res.RedirectLimitReached = trace.limited
+	res.ProxyConnect = proxied.duration()
+	if err != nil {
+		return nil, proxied.classify(err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && p.tokens != nil {
+		p.tokens.invalidate()
+	}
+
+	res.URL = resp.Request.URL.String()
+	res.TLS = resp.TLS
+	return resp, nil
+}
+
+// setHeaders adds the headers to the request, using any Host
+// header as the request host
+func setHeaders(req *http.Request, headers http.Header) {
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	if host := headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+}
+
 // Validate checks whether there are enough valid data to
 // carry out a probe check. Returns nil if no problems, otherwise
 // returns an Error with the reason for failure.
@@ -236,5 +483,46 @@ func (p *Probe) Validate() error {
 		return ErrInvalidSuccessFilterEmpty
 	}
 
+	if len(p.steps) > 0 && p.payload != "" {
+		return fmt.Errorf("%v: payload is set by each step rather than the probe", ErrInvalidSteps)
+	}
+
+	if p.eachAddress {
+		if p.kind == "PING" || p.kind == "EXEC" {
+			return fmt.Errorf("%v: not supported by %s probes", ErrInvalidEachAddress, p.kind)
+		}
+		if p.literalEndpoint || !strings.Contains(p.endpoint, "{{") {
+			if u, err := url.Parse(p.endpoint); err != nil || u.Hostname() == "" {
+				return fmt.Errorf("%v: endpoint must be a URL with a host", ErrInvalidEachAddress)
+			}
+		}
+	}
+
+	templates := []string{p.payload}
+	if !p.literalEndpoint {
+		templates = append(templates, p.endpoint)
+	}
+	templates = append(templates, p.execArgs...)
+	templates = append(templates, p.execEnv...)
+	for _, values := range p.headers {
+		templates = append(templates, values...)
+	}
+	if p.tokens != nil {
+		templates = append(templates, p.tokens.clientSecret)
+	}
+	for _, step := range p.steps {
+		templates = append(templates, step.URL, step.Payload)
+		for _, value := range step.Headers {
+			templates = append(templates, value)
+		}
+	}
+	for _, text := range templates {
+		if strings.Contains(text, "{{") {
+			if _, err := parseTemplate(text, p.templateSecrets); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
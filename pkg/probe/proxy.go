@@ -0,0 +1,251 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+)
+
+// proxyTraceKey is the context key for the proxyTrace of a request
+type proxyTraceKey struct{}
+
+// proxyTrace records the proxy used for a request and how long it
+// took to connect through it. Any failure after starting to connect
+// to the proxy and before the connection through it is ready is a
+// failure of the proxy rather than the endpoint.
+type proxyTrace struct {
+	mu      sync.Mutex
+	proxy   *url.URL
+	start   time.Time
+	connect time.Duration
+	pending bool
+}
+
+// traceProxy returns the request with a proxyTrace attached, which
+// is also marked connected when the request gets its connection
+func traceProxy(req *http.Request) (*http.Request, *proxyTrace) {
+	trace := &proxyTrace{}
+	ctx := context.WithValue(req.Context(), proxyTraceKey{}, trace)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { trace.connected() },
+	})
+	return req.WithContext(ctx), trace
+}
+
+// proxyTraceFrom returns the proxyTrace attached to the context,
+// or nil if there is none
+func proxyTraceFrom(ctx context.Context) *proxyTrace {
+	trace, _ := ctx.Value(proxyTraceKey{}).(*proxyTrace)
+	return trace
+}
+
+// use sets the proxy chosen for the request
+func (t *proxyTrace) use(proxy *url.URL) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.proxy = proxy
+}
+
+// proxyURL returns the proxy chosen for the request, if any
+func (t *proxyTrace) proxyURL() *url.URL {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.proxy
+}
+
+// connecting marks the start of connecting to the proxy
+func (t *proxyTrace) connecting() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start = time.Now()
+	t.pending = true
+}
+
+// connected marks the connection through the proxy as ready
+func (t *proxyTrace) connected() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending {
+		t.connect += time.Since(t.start)
+		t.pending = false
+	}
+}
+
+// duration returns the total time spent connecting through the proxy
+func (t *proxyTrace) duration() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connect
+}
+
+// classify marks err as a proxy failure if it happened while
+// connecting through the proxy
+func (t *proxyTrace) classify(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.pending || errors.Is(err, ErrProxy) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrProxy, err)
+}
+
+// proxyFor is the probe transport's Proxy function, which chooses the
+// proxy for a request and records it on the request's proxyTrace.
+// SOCKS5 proxies are not returned to the transport, as the probe
+// connects through them itself in dial.
+func (p *Probe) proxyFor(req *http.Request) (*url.URL, error) {
+	proxy, err := p.proxy(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrProxy, err)
+	}
+	proxyTraceFrom(req.Context()).use(proxy)
+	if proxy != nil && isSOCKS(proxy) {
+		return nil, nil
+	}
+	return proxy, nil
+}
+
+// proxyConnectResponse marks the connection through an HTTP proxy
+// as ready when it accepts a CONNECT request
+func (p *Probe) proxyConnectResponse(ctx context.Context, proxy *url.URL, req *http.Request, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		proxyTraceFrom(ctx).connected()
+	}
+	return nil
+}
+
+// dialProxy makes a connection for the probe's dial method through
+// the proxy chosen for the request, if any
+func (p *Probe) dialProxy(ctx context.Context, network string, addr string) (net.Conn, error) {
+	trace := proxyTraceFrom(ctx)
+	proxy := trace.proxyURL()
+	if proxy == nil {
+		return p.dialer.DialContext(ctx, network, p.dialAddress(ctx, addr))
+	}
+
+	trace.connecting()
+	if !isSOCKS(proxy) {
+		// The transport only dials HTTP proxies when one is in use
+		return p.dialer.DialContext(ctx, network, addr)
+	}
+
+	// A socks5 proxy is given the address of the host, looked up
+	// locally, while a socks5h proxy looks up the host itself
+	target := p.dialAddress(ctx, addr)
+	if proxy.Scheme == "socks5" {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := p.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		target = net.JoinHostPort(ips[0], port)
+	}
+
+	var auth *xproxy.Auth
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		auth = &xproxy.Auth{User: proxy.User.Username(), Password: password}
+	}
+	d, err := xproxy.SOCKS5(network, proxyAddr(proxy), auth, p.dialer)
+	if err != nil {
+		return nil, err
+	}
+	if p.dialer.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.dialer.Timeout)
+		defer cancel()
+	}
+	conn, err := d.(xproxy.ContextDialer).DialContext(ctx, network, target)
+	if err != nil {
+		return nil, err
+	}
+	trace.connected()
+	return conn, nil
+}
+
+// isSOCKS reports whether the proxy is a SOCKS5 proxy
+func isSOCKS(proxy *url.URL) bool {
+	return proxy.Scheme == "socks5" || proxy.Scheme == "socks5h"
+}
+
+// proxyAddr returns the host and port of the proxy, using the
+// default port for its scheme if none is given
+func proxyAddr(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	port := "1080"
+	switch proxy.Scheme {
+	case "http":
+		port = "80"
+	case "https":
+		port = "443"
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// WithProxy sends requests through the proxy at the URL. HTTP proxies
+// (http:// or https://) forward requests to HTTP endpoints and tunnel
+// to HTTPS endpoints with CONNECT, and SOCKS5 proxies tunnel to any
+// endpoint, where a socks5:// proxy is given the IP address of the
+// endpoint, looked up by the probe, and a socks5h:// proxy looks up
+// the endpoint's host name itself. Any username and password in the
+// URL are used to authenticate with the proxy.
+//
+// If not used, the proxy is taken from the environment, see
+// WithProxyFromEnvironment
+func WithProxy(proxyURL string) Option {
+	return func(p *Probe) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("%v: %v", ErrInvalidProxy, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("%v: unsupported scheme %q", ErrInvalidProxy, u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("%v: no host in %q", ErrInvalidProxy, proxyURL)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.proxy = http.ProxyURL(u)
+		return nil
+	}
+}
+
+// WithProxyFromEnvironment sends requests through the proxy given by
+// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables,
+// as for http.ProxyFromEnvironment
+func WithProxyFromEnvironment() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.proxy = http.ProxyFromEnvironment
+		return nil
+	}
+}
@@ -0,0 +1,298 @@
+package probe_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// pipe copies between the connections until either is closed
+func pipe(a net.Conn, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+	go io.Copy(a, b)
+	io.Copy(b, a)
+}
+
+// newHTTPProxy starts an HTTP proxy which forwards requests and
+// tunnels CONNECT requests, requiring the credentials if given
+func newHTTPProxy(t *testing.T, user string, password string) *httptest.Server {
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user != "" && r.Header.Get("Proxy-Authorization") != want {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method == http.MethodConnect {
+			target, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+			buf.Flush()
+			pipe(conn, target)
+			return
+		}
+
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+}
+
+// newSOCKSProxy starts a SOCKS5 proxy requiring the credentials if
+// given, and returns its address. The host of each connection asked
+// for is sent on requested, if not nil.
+func newSOCKSProxy(t *testing.T, user string, password string, requested chan<- string) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		head := make([]byte, 2)
+		io.ReadFull(r, head)
+		io.ReadFull(r, make([]byte, head[1]))
+		if user == "" {
+			conn.Write([]byte{0x05, 0x00})
+		} else {
+			conn.Write([]byte{0x05, 0x02})
+			io.ReadFull(r, head)
+			u := make([]byte, head[1])
+			io.ReadFull(r, u)
+			n, _ := r.ReadByte()
+			pw := make([]byte, n)
+			io.ReadFull(r, pw)
+			if string(u) != user || string(pw) != password {
+				conn.Write([]byte{0x01, 0x01})
+				conn.Close()
+				return
+			}
+			conn.Write([]byte{0x01, 0x00})
+		}
+
+		req := make([]byte, 4)
+		io.ReadFull(r, req)
+		var host string
+		switch req[3] {
+		case 0x01:
+			ip := make([]byte, 4)
+			io.ReadFull(r, ip)
+			host = net.IP(ip).String()
+		case 0x03:
+			n, _ := r.ReadByte()
+			name := make([]byte, n)
+			io.ReadFull(r, name)
+			host = string(name)
+		}
+		port := make([]byte, 2)
+		io.ReadFull(r, port)
+		if requested != nil {
+			requested <- host
+		}
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))))
+		if err != nil {
+			conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+			conn.Close()
+			return
+		}
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		pipe(conn, target)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func TestProxy(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+
+	httpProxy := newHTTPProxy(t, "alien", "secret")
+	defer httpProxy.Close()
+	socksAddr, closeSOCKS := newSOCKSProxy(t, "alien", "secret", nil)
+	defer closeSOCKS()
+	httpAuth := strings.Replace(httpProxy.URL, "http://", "http://alien:secret@", 1)
+
+	var proxySets = []struct {
+		name     string
+		endpoint string
+		proxy    string
+	}{
+		{name: "forward", endpoint: plain.URL, proxy: httpAuth},
+		{name: "connect", endpoint: secure.URL, proxy: httpAuth},
+		{name: "socks5 http", endpoint: plain.URL, proxy: "socks5://alien:secret@" + socksAddr},
+		{name: "socks5 https", endpoint: secure.URL, proxy: "socks5://alien:secret@" + socksAddr},
+	}
+
+	for _, ps := range proxySets {
+		p, err := probe.New(ps.endpoint,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithProxy(ps.proxy),
+			probe.WithTLSInsecureSkipVerify(),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", ps.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil || res.Error != nil {
+			t.Errorf("%s: Check: %v %v", ps.name, err, res.Error)
+			continue
+		}
+		if !res.Success {
+			t.Errorf("%s: want success, got code %d", ps.name, res.Code)
+		}
+		if res.ProxyConnect <= 0 {
+			t.Errorf("%s: want proxy connect time recorded, got %s", ps.name, res.ProxyConnect)
+		}
+	}
+}
+
+func TestProxyFailure(t *testing.T) {
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer secure.Close()
+
+	httpProxy := newHTTPProxy(t, "alien", "secret")
+	defer httpProxy.Close()
+	socksAddr, closeSOCKS := newSOCKSProxy(t, "alien", "secret", nil)
+	defer closeSOCKS()
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	var failureSets = []struct {
+		name    string
+		options []probe.Option
+		proxy   bool
+	}{
+		{
+			name:    "connect unauthorised",
+			options: []probe.Option{probe.WithProxy(httpProxy.URL), probe.WithTLSInsecureSkipVerify()},
+			proxy:   true,
+		},
+		{
+			name:    "socks5 unauthorised",
+			options: []probe.Option{probe.WithProxy("socks5://alien:wrong@" + socksAddr), probe.WithTLSInsecureSkipVerify()},
+			proxy:   true,
+		},
+		{
+			name:    "socks5 username too long",
+			options: []probe.Option{probe.WithProxy("socks5://" + strings.Repeat("a", 256) + ":secret@" + socksAddr), probe.WithTLSInsecureSkipVerify()},
+			proxy:   true,
+		},
+		{
+			name:    "proxy unreachable",
+			options: []probe.Option{probe.WithProxy("http://" + closedAddr), probe.WithTLSInsecureSkipVerify()},
+			proxy:   true,
+		},
+		{
+			name:    "endpoint untrusted",
+			options: []probe.Option{probe.WithProxy(strings.Replace(httpProxy.URL, "http://", "http://alien:secret@", 1))},
+			proxy:   false,
+		},
+	}
+
+	for _, fs := range failureSets {
+		options := append(fs.options,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		)
+		p, err := probe.New(secure.URL, options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", fs.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", fs.name, err)
+		}
+		if res.Error == nil {
+			t.Errorf("%s: want error, got code %d", fs.name, res.Code)
+			continue
+		}
+		if errors.Is(res.Error, probe.ErrProxy) != fs.proxy {
+			t.Errorf("%s: want proxy failure %t, got %v", fs.name, fs.proxy, res.Error)
+		}
+	}
+}
+
+func TestProxyInvalid(t *testing.T) {
+	for _, proxy := range []string{"ftp://proxy:21", "http://", "::"} {
+		if _, err := probe.New("http://localhost", probe.WithProxy(proxy)); err == nil {
+			t.Errorf("%q: want error", proxy)
+		}
+	}
+}
+
+func TestProxySOCKSResolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	requested := make(chan string, 1)
+	socksAddr, closeSOCKS := newSOCKSProxy(t, "", "", requested)
+	defer closeSOCKS()
+
+	// A socks5 proxy is given the address, and a socks5h proxy the name
+	for scheme, want := range map[string]string{"socks5": "127.0.0.1", "socks5h": "localhost"} {
+		p, err := probe.New("http://localhost:"+port,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithProxy(scheme+"://"+socksAddr),
+			probe.WithIPVersion(4),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", scheme, err)
+		}
+		res, err := p.Check(context.Background())
+		if err != nil || !res.Success {
+			t.Errorf("%s: want success, got %v %v", scheme, err, res.Error)
+			continue
+		}
+		if got := <-requested; got != want {
+			t.Errorf("%s: want proxy asked for %s, got %s", scheme, want, got)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// defaultRedirectLimit is the most redirects followed unless
+// changed with WithRedirectLimit. This is one more than net/http,
+// which stops after 10 requests and so follows 9 redirects.
+const defaultRedirectLimit = 10
+
+// Redirect is a single hop in the redirect chain of a Result, with
+// the URL which responded with a redirect, the response code and
+// how long that request took
+type Redirect struct {
+	URL      string
+	Code     int
+	Duration time.Duration
+}
+
+// redirectTraceKey is the context key for the redirectTrace of a request
+type redirectTraceKey struct{}
+
+// redirectTrace collects the redirect chain of a single request,
+// and whether a redirect was not followed due to the limit
+type redirectTrace struct {
+	mark    time.Time
+	chain   []Redirect
+	limited bool
+}
+
+// traceRedirects returns the request with a redirectTrace attached
+func traceRedirects(req *http.Request) (*http.Request, *redirectTrace) {
+	trace := &redirectTrace{mark: time.Now()}
+	return req.WithContext(context.WithValue(req.Context(), redirectTraceKey{}, trace)), trace
+}
+
+// checkRedirect is the probe client's redirect policy, which decides
+// whether to follow each redirect and records those it follows. When
+// a redirect is not followed the redirect response is the result.
+func (p *Probe) checkRedirect(req *http.Request, via []*http.Request) error {
+	trace, _ := req.Context().Value(redirectTraceKey{}).(*redirectTrace)
+	// via holds the requests made so far, one more than the
+	// redirects followed
+	if len(via) > p.redirectLimit {
+		if trace != nil {
+			trace.limited = true
+		}
+		return http.ErrUseLastResponse
+	}
+	if p.redirectSameHost && req.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+
+	if trace != nil && req.Response != nil {
+		now := time.Now()
+		trace.chain = append(trace.chain, Redirect{
+			URL:      via[len(via)-1].URL.String(),
+			Code:     req.Response.StatusCode,
+			Duration: now.Sub(trace.mark),
+		})
+		trace.mark = now
+	}
+	return nil
+}
+
+// WithRedirectLimit sets the most redirects the probe follows, making
+// at most max+1 requests. When the limit is reached the last redirect
+// response is the result, with RedirectLimitReached set, so a limit
+// of 0 never follows redirects.
+//
+// If not used, the default is 10 redirects, one more than the default
+// net/http client follows
+func WithRedirectLimit(max int) Option {
+	return func(p *Probe) error {
+		if max < 0 {
+			return ErrInvalidRedirectLimit
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.redirectLimit = max
+		return nil
+	}
+}
+
+// WithRedirectSameHost only follows redirects to the same host as
+// the original request, otherwise the redirect response is the result
+func WithRedirectSameHost() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.redirectSameHost = true
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package probe_test
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusMovedPermanently))
+	mux.Handle("/b", http.RedirectHandler("/login", http.StatusFound))
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Handle("/away", http.RedirectHandler(other.URL+"/elsewhere", http.StatusFound))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var redirectSets = []struct {
+		name      string
+		path      string
+		options   []probe.Option
+		code      int
+		finalURL  string
+		redirects []int
+		limited   bool
+	}{
+		{name: "follow", path: "/a", code: 200, finalURL: srv.URL + "/login", redirects: []int{301, 302}},
+		{name: "don't follow", path: "/a", options: []probe.Option{probe.WithRedirectLimit(0)}, code: 301, finalURL: srv.URL + "/a", limited: true},
+		{name: "max hops", path: "/a", options: []probe.Option{probe.WithRedirectLimit(1)}, code: 302, finalURL: srv.URL + "/b", redirects: []int{301}, limited: true},
+		{name: "exactly max hops", path: "/a", options: []probe.Option{probe.WithRedirectLimit(2)}, code: 200, finalURL: srv.URL + "/login", redirects: []int{301, 302}},
+		{name: "off host", path: "/away", code: 200, finalURL: other.URL + "/elsewhere", redirects: []int{302}},
+		{name: "same host only", path: "/away", options: []probe.Option{probe.WithRedirectSameHost()}, code: 302, finalURL: srv.URL + "/away"},
+	}
+
+	for _, rs := range redirectSets {
+		options := append(rs.options,
+			probe.WithSuccessFilter(probe.FilterGroupAll{
+				Members: []probe.ResultFilter{
+					probe.FilterFinalURL(rs.finalURL),
+					probe.FilterRedirectCount(len(rs.redirects)),
+				},
+			}),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		p, err := probe.New(srv.URL+rs.path, options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", rs.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil || res.Error != nil {
+			t.Fatalf("%s: Check: %v %v", rs.name, err, res.Error)
+		}
+		if res.Code != rs.code {
+			t.Errorf("%s: want code %d, got %d", rs.name, rs.code, res.Code)
+		}
+		if res.RedirectLimitReached != rs.limited {
+			t.Errorf("%s: want redirect limit reached %t, got %t", rs.name, rs.limited, res.RedirectLimitReached)
+		}
+		if !res.Success {
+			t.Errorf("%s: want final URL %s after %d redirects, got %s after %+v", rs.name, rs.finalURL, len(rs.redirects), res.URL, res.Redirects)
+			continue
+		}
+		for i, code := range rs.redirects {
+			if res.Redirects[i].Code != code {
+				t.Errorf("%s: hop %d: want code %d, got %+v", rs.name, i, code, res.Redirects[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// addressKey is the context key for the pinnedAddress of a request
+type addressKey struct{}
+
+// pinnedAddress is the IP address a request's connections to a
+// host are made to
+type pinnedAddress struct {
+	host string
+	ip   string
+}
+
+// dialAddress returns the address to connect to for addr, which is
+// the IP address the request pins its host to or the override for
+// its host if either is set, otherwise addr itself
+func (p *Probe) dialAddress(ctx context.Context, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if pin, ok := ctx.Value(addressKey{}).(pinnedAddress); ok && pin.host == host {
+		return net.JoinHostPort(pin.ip, port)
+	}
+	if ip, ok := p.hosts[host]; ok {
+		return net.JoinHostPort(ip, port)
+	}
+	return addr
+}
+
+// lookup returns the IP addresses of the host, using any override
+// for the host and otherwise the probe's resolver
+func (p *Probe) lookup(ctx context.Context, host string) ([]string, error) {
+	if ip, ok := p.hosts[host]; ok {
+		return []string{ip}, nil
+	}
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	network := "ip"
+	switch p.network {
+	case "tcp4":
+		network = "ip4"
+	case "tcp6":
+		network = "ip6"
+	}
+
+	resolver := p.dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ips, err := resolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	return addrs, nil
+}
+
+// doAddresses carries out the probe's check against each address
+// the endpoint resolves to, recording the Result of each address and
+// the response of the last address checked
+func (p *Probe) doAddresses(ctx context.Context, res *Result) error {
+	endpoint, _, _, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("%v: endpoint must be a URL with a host", ErrInvalidEachAddress)
+	}
+	addrs, err := p.lookup(ctx, u.Hostname())
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	for _, addr := range addrs {
+		ar := Result{
+			Timestamp: time.Now(),
+			Probe:     p,
+			Address:   addr,
+		}
+
+		// Idle connections may be to a different address
+		p.transport.CloseIdleConnections()
+		ar.Error = p.checker(context.WithValue(ctx, addressKey{}, pinnedAddress{host: u.Hostname(), ip: addr}), &ar)
+		ar.Latency = time.Since(ar.Timestamp)
+		if ar.Error == nil {
+			ar.Success = p.success.Check(&ar)
+		}
+		res.Addresses = append(res.Addresses, ar)
+
+		res.Code = ar.Code
+		res.Headers = ar.Headers
+		res.Body = ar.Body
+		res.URL = ar.URL
+		res.Redirects = ar.Redirects
+		res.Steps = ar.Steps
+
+		if failed != nil {
+			continue
+		}
+		if ar.Error != nil {
+			failed = fmt.Errorf("address %s: %w", addr, ar.Error)
+		} else if !ar.Success {
+			failed = fmt.Errorf("%v: %s", ErrAddressFailed, addr)
+		}
+	}
+
+	return failed
+}
+
+// WithResolver looks up endpoint host names with the DNS server at
+// the address, which is a host and optional port defaulting to 53
+//
+// If not used, the system resolver is used
+func WithResolver(address string) Option {
+	return func(p *Probe) error {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "53")
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("%v: %v", ErrInvalidResolver, err)
+		}
+
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.dialer.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, address)
+			},
+		}
+		return nil
+	}
+}
+
+// WithHostOverride connects to the IP address instead of looking up
+// the host, like curl's --resolve. The endpoint's host is still used
+// for the Host header and TLS server name, so a single backend behind
+// a load balancer can be checked.
+func WithHostOverride(host string, ip string) Option {
+	return func(p *Probe) error {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("%v: %q is not an IP address", ErrInvalidHostOverride, ip)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		if p.hosts == nil {
+			p.hosts = make(map[string]string)
+		}
+		p.hosts[host] = ip
+		return nil
+	}
+}
+
+// WithEachAddress checks every IP address the endpoint's host resolves
+// to, rather than whichever the connection is made to. Each address
+// has its own Result in the Addresses of the overall Result, which
+// otherwise holds the response of the last address checked, and the
+// probe only succeeds if every address passes the success filter.
+//
+// Addresses are connected to directly or through a SOCKS5 proxy, as
+// HTTP proxies look up the host themselves. The endpoint must be a
+// URL with a host, such as udp://host:port rather than host:port, and
+// ping and exec probes cannot check each address, which is an
+// ErrInvalidEachAddress error.
+func WithEachAddress() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.eachAddress = true
+		return nil
+	}
+}
@@ -0,0 +1,226 @@
+package probe_test
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// newDNSServer starts a DNS server answering A queries for the
+// names given, and returns its address
+func newDNSServer(t *testing.T, records map[string][]string) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+
+			// Read the question name, then its type and class
+			var labels []string
+			i := 12
+			for i < n && query[i] != 0 {
+				labels = append(labels, string(query[i+1:i+1+int(query[i])]))
+				i += 1 + int(query[i])
+			}
+			qtype := int(query[i+1])<<8 | int(query[i+2])
+			question := query[12 : i+5]
+
+			var ips []string
+			addrs, known := records[strings.Join(labels, ".")]
+			if qtype == 1 {
+				ips = addrs
+			}
+
+			resp := []byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, byte(len(ips)), 0, 0, 0, 0}
+			if !known {
+				resp[3] = 0x83
+			}
+			resp = append(resp, question...)
+			for _, ip := range ips {
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, net.ParseIP(ip).To4()...)
+			}
+			conn.WriteTo(resp, from)
+		}
+	}()
+
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+// newAddressServer starts a server on every local address which
+// responds with the host requested and the address connected to
+func newAddressServer(t *testing.T) (*httptest.Server, string) {
+	l, err := net.Listen("tcp4", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		local := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+		host, _, _ := net.SplitHostPort(local.String())
+		w.Write([]byte(r.Host + " " + host))
+	}))
+	srv.Listener = l
+	srv.Start()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return srv, port
+}
+
+func TestResolve(t *testing.T) {
+	srv, port := newAddressServer(t)
+	defer srv.Close()
+	dns, closeDNS := newDNSServer(t, map[string][]string{
+		"alien.test": {"127.0.0.2"},
+	})
+	defer closeDNS()
+
+	var resolveSets = []struct {
+		name    string
+		host    string
+		options []probe.Option
+		body    string
+	}{
+		{
+			name:    "resolver",
+			host:    "alien.test",
+			options: []probe.Option{probe.WithResolver(dns)},
+			body:    "alien.test:" + port + " 127.0.0.2",
+		},
+		{
+			name:    "override",
+			host:    "backend.test",
+			options: []probe.Option{probe.WithHostOverride("backend.test", "127.0.0.3")},
+			body:    "backend.test:" + port + " 127.0.0.3",
+		},
+		{
+			name:    "override before resolver",
+			host:    "alien.test",
+			options: []probe.Option{probe.WithResolver(dns), probe.WithHostOverride("alien.test", "127.0.0.4")},
+			body:    "alien.test:" + port + " 127.0.0.4",
+		},
+	}
+
+	for _, rs := range resolveSets {
+		options := append(rs.options,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithSuccessFilter(probe.FilterResponseContains(rs.body)),
+		)
+		p, err := probe.New("http://"+net.JoinHostPort(rs.host, port)+"/", options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", rs.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil || res.Error != nil {
+			t.Errorf("%s: Check: %v %v", rs.name, err, res.Error)
+			continue
+		}
+		if !res.Success {
+			t.Errorf("%s: want %q, got %q", rs.name, rs.body, res.Body)
+		}
+	}
+}
+
+func TestEachAddress(t *testing.T) {
+	srv, port := newAddressServer(t)
+	defer srv.Close()
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, closedPort, _ := net.SplitHostPort(closed.Addr().String())
+	closed.Close()
+	dns, closeDNS := newDNSServer(t, map[string][]string{
+		"pool.test": {"127.0.0.5", "127.0.0.6"},
+	})
+	defer closeDNS()
+
+	p, err := probe.New("http://pool.test:"+port+"/",
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithResolver(dns),
+		probe.WithEachAddress(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	res, err := p.Check(context.Background())
+	if err != nil || res.Error != nil {
+		t.Fatalf("Check: %v %v", err, res.Error)
+	}
+	if !res.Success || len(res.Addresses) != 2 {
+		t.Fatalf("want 2 successful addresses, got %t %+v", res.Success, res.Addresses)
+	}
+	for _, ar := range res.Addresses {
+		if want := "pool.test:" + port + " " + ar.Address; ar.Body != want {
+			t.Errorf("%s: want %q, got %q", ar.Address, want, ar.Body)
+		}
+	}
+
+	// An address which fails fails the probe
+	p, err = probe.New("http://pool.test:"+closedPort+"/",
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		probe.WithResolver(dns),
+		probe.WithHostOverride("pool.test", "127.0.0.1"),
+		probe.WithEachAddress(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	res, _ = p.Check(context.Background())
+	if res.Error == nil || len(res.Addresses) != 1 || res.Addresses[0].Error == nil {
+		t.Errorf("want failed address, got %v %+v", res.Error, res.Addresses)
+	}
+}
+
+func TestResolveInvalid(t *testing.T) {
+	var invalidSets = []probe.Option{
+		probe.WithHostOverride("alien.test", "not-an-ip"),
+		probe.WithResolver("[::1"),
+	}
+	for i, option := range invalidSets {
+		if _, err := probe.New("http://localhost", option); err == nil {
+			t.Errorf("%d: want error", i)
+		}
+	}
+}
+
+func TestEachAddressInvalid(t *testing.T) {
+	var invalidSets = []struct {
+		endpoint string
+		option   probe.Option
+	}{
+		{endpoint: "localhost", option: probe.WithPing(1, time.Millisecond)},
+		{endpoint: "/bin/true", option: probe.WithExec()},
+		{endpoint: "localhost:514", option: probe.WithUDP()},
+		{endpoint: "127.0.0.1:514", option: probe.WithUDP()},
+	}
+	for _, is := range invalidSets {
+		p, err := probe.New(is.endpoint,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			is.option,
+			probe.WithEachAddress(),
+			probe.WithSuccessFilter(probe.FilterResponseCode(0)),
+		)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", is.endpoint, err)
+		}
+		if err := p.Validate(); err == nil || !strings.HasPrefix(err.Error(), probe.ErrInvalidEachAddress.Error()) {
+			t.Errorf("%s: want each address error, got %v", is.endpoint, err)
+		}
+	}
+}
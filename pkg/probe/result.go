@@ -1,17 +1,85 @@
 package probe
 
 import (
+	"crypto/tls"
 	"net/http"
 	"time"
 )
 
+// Result is the outcome of a single probe check
 type Result struct {
 	Timestamp time.Time
+	Latency   time.Duration
 	Probe     *Probe
 
-	Code    int
-	Body    string
-	Headers http.Header
+	Code     int
+	Body     string
+	Headers  http.Header
+	Trailers http.Header
 
-	Error error
+	// GRPCStatus is the status code of a gRPC call, and HealthStatus
+	// the serving status reported by a gRPC health check
+	GRPCStatus   int
+	HealthStatus string
+
+	// Handshake is the time taken to open a WebSocket connection,
+	// and RoundTrip the time from sending a WebSocket message or UDP
+	// datagram to the reply
+	Handshake time.Duration
+	RoundTrip time.Duration
+
+	// PacketsSent and PacketsReceived count the echo requests and
+	// replies of a ping, with PacketLoss the percentage of requests
+	// unanswered. RTTs holds the round trip time of each reply, in the
+	// order the requests were sent, and Jitter is the mean difference
+	// between consecutive round trip times.
+	PacketsSent     int
+	PacketsReceived int
+	PacketLoss      float64
+	RTTMin          time.Duration
+	RTTAvg          time.Duration
+	RTTMax          time.Duration
+	Jitter          time.Duration
+	RTTs            []time.Duration
+
+	// Capabilities are the extensions or capabilities a mail server
+	// offers, one per entry, such as "STARTTLS" or "SIZE 10240000"
+	Capabilities []string
+
+	// TLS is the state of the TLS connection a response was received
+	// on, including the server's certificates, if any
+	TLS *tls.ConnectionState
+
+	// Stderr is the standard error of a command, and Perfdata the
+	// performance data in its output
+	Stderr   string
+	Perfdata []Perfdata
+
+	// URL is the final URL requested, and Redirects the chain
+	// of redirects followed to reach it. RedirectLimitReached is set
+	// when the response is a redirect which was not followed because
+	// the redirect limit had been reached.
+	URL                  string
+	Redirects            []Redirect
+	RedirectLimitReached bool
+
+	// ProxyConnect is the time spent connecting through a proxy,
+	// which is zero when an existing connection was reused
+	ProxyConnect time.Duration
+
+	Success bool
+	Error   error
+
+	// Step and Steps are set for probes made up of steps, where
+	// Step names the step a Result is for, and Steps holds the
+	// Result of each step run in the overall Result
+	Step  string
+	Steps []Result
+
+	// Address and Addresses are set for probes which check every
+	// address of the endpoint, where Address is the IP address a
+	// Result is for, and Addresses holds the Result of each address
+	// checked in the overall Result
+	Address   string
+	Addresses []Result
 }
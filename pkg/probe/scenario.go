@@ -0,0 +1,162 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Step is a single request in a probe made up of steps. The URL,
+// headers and payload are request templates which may also refer
+// to values extracted by earlier steps, for example {{.token}}.
+type Step struct {
+	// Name identifies the step in results and metrics, and
+	// defaults to step1, step2 and so on
+	Name string
+
+	// Method defaults to GET
+	Method string
+
+	// URL is resolved relative to the probe endpoint, so may be
+	// just a path
+	URL     string
+	Headers map[string]string
+	Payload string
+
+	// Filter must pass for the probe to carry on to the next
+	// step, and if nil any response is accepted
+	Filter ResultFilter
+
+	// Extract maps variable names to expressions understood by
+	// Extract, and the values are available to later steps
+	Extract map[string]string
+}
+
+// WithSteps makes the probe carry out each step in order, stopping
+// at the first which fails. Each step has its own Result in the
+// Steps of the overall Result, which otherwise holds the response
+// of the last step run. The success filter is checked against the
+// last step once all steps have passed. Each step has its own
+// payload, so the probe cannot also have one set with WithPayload.
+func WithSteps(steps ...Step) Option {
+	return func(p *Probe) error {
+		if len(steps) == 0 {
+			return ErrInvalidSteps
+		}
+
+		// Defaults are filled in on a copy, so that the same steps
+		// can be given to several probes
+		steps := append([]Step(nil), steps...)
+		names := make(map[string]bool)
+		for i := range steps {
+			if steps[i].Name == "" {
+				steps[i].Name = fmt.Sprintf("step%d", i+1)
+			}
+			if names[steps[i].Name] {
+				return fmt.Errorf("%v: duplicate step name %q", ErrInvalidSteps, steps[i].Name)
+			}
+			names[steps[i].Name] = true
+			if steps[i].Method == "" {
+				steps[i].Method = http.MethodGet
+			}
+		}
+
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.steps = steps
+		p.kind = fmt.Sprintf("STEPS[%d]", len(steps))
+		p.checker = p.doSteps
+		return nil
+	}
+}
+
+// doSteps carries out each step in turn, recording the Result of
+// each step and the response of the last step run
+func (p *Probe) doSteps(ctx context.Context, res *Result) error {
+	endpoint, headers, _, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+
+	vars := make(map[string]string)
+	for _, step := range p.steps {
+		sr := Result{
+			Timestamp: time.Now(),
+			Probe:     p,
+			Step:      step.Name,
+		}
+
+		sr.Error = p.doStep(ctx, step, base, headers, vars, &sr)
+		sr.Latency = time.Since(sr.Timestamp)
+		sr.Success = sr.Error == nil
+		res.Steps = append(res.Steps, sr)
+
+		res.Code = sr.Code
+		res.Headers = sr.Headers
+		res.Body = sr.Body
+
+		if sr.Error != nil {
+			return fmt.Errorf("step %q: %w", step.Name, sr.Error)
+		}
+	}
+
+	return nil
+}
+
+// doStep makes the request for a single step, checks its filter
+// and extracts its variables
+func (p *Probe) doStep(ctx context.Context, step Step, base *url.URL, probeHeaders http.Header, vars map[string]string, res *Result) error {
+	target, err := render(step.URL, vars, p.templateSecrets)
+	if err != nil {
+		return err
+	}
+	ref, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	payload, err := render(step.Payload, vars, p.templateSecrets)
+	if err != nil {
+		return err
+	}
+
+	headers := probeHeaders.Clone()
+	for k, v := range step.Headers {
+		value, err := render(v, vars, p.templateSecrets)
+		if err != nil {
+			return err
+		}
+		headers.Set(k, value)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, step.Method, base.ResolveReference(ref).String(), bytes.NewBufferString(payload))
+	if err != nil {
+		return err
+	}
+	setHeaders(req, headers)
+
+	if err := p.roundTrip(req, res); err != nil {
+		return err
+	}
+
+	if step.Filter != nil && !step.Filter.Check(res) {
+		return ErrStepFailed
+	}
+
+	for name, expr := range step.Extract {
+		v, err := Extract(res, expr)
+		if err != nil {
+			return err
+		}
+		vars[name] = v
+	}
+
+	return nil
+}
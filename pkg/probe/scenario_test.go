@@ -0,0 +1,177 @@
+package probe_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func newScenarioServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		var creds map[string]string
+		json.NewDecoder(r.Body).Decode(&creds)
+		if r.Method != http.MethodPost || creds["user"] != "alien" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"data": {"token": "abc123", "scopes": ["read"]}}`))
+	})
+	mux.HandleFunc("/api/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"items": [{"id": 7}]}`))
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSteps(t *testing.T) {
+	srv := newScenarioServer()
+	defer srv.Close()
+
+	var stepSets = []struct {
+		user   string
+		pass   bool
+		steps  int
+		failed string
+	}{
+		{user: "alien", pass: true, steps: 3},
+		{user: "human", pass: false, steps: 1, failed: "login"},
+	}
+
+	for _, ss := range stepSets {
+		p, err := probe.New(srv.URL,
+			probe.WithSteps(
+				probe.Step{
+					Name:    "login",
+					Method:  http.MethodPost,
+					URL:     "/login",
+					Payload: `{"user": "` + ss.user + `"}`,
+					Filter:  probe.FilterResponseCode(200),
+					Extract: map[string]string{"token": "json:data.token"},
+				},
+				probe.Step{
+					URL:     "/api/items",
+					Headers: map[string]string{"Authorization": "Bearer {{.token}}"},
+					Filter:  probe.FilterResponseContains(`"id": 7`),
+				},
+				probe.Step{
+					Name:   "logout",
+					Method: http.MethodPost,
+					URL:    "/logout",
+				},
+			),
+			probe.WithSuccessFilter(probe.FilterResponseCode(http.StatusNoContent)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		if err != nil {
+			t.Fatalf("New probe: %v", err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+
+		if res.Success != ss.pass {
+			t.Errorf("user %s: want success=%t, got %t (%v)", ss.user, ss.pass, res.Success, res.Error)
+		}
+		if len(res.Steps) != ss.steps {
+			t.Fatalf("user %s: want %d steps, got %d", ss.user, ss.steps, len(res.Steps))
+		}
+		if ss.pass && res.Steps[1].Step != "step2" {
+			t.Errorf("want default step name step2, got %q", res.Steps[1].Step)
+		}
+		if ss.failed != "" {
+			last := res.Steps[len(res.Steps)-1]
+			if last.Step != ss.failed || last.Success || last.Code != http.StatusUnauthorized {
+				t.Errorf("user %s: want failed step %s, got %+v", ss.user, ss.failed, last)
+			}
+		}
+	}
+}
+
+func TestStepsShared(t *testing.T) {
+	steps := []probe.Step{{URL: "/a"}, {URL: "/b"}}
+	for i := 0; i < 2; i++ {
+		if _, err := probe.New("http://example.invalid",
+			probe.WithSteps(steps...),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		); err != nil {
+			t.Fatalf("New probe %d: %v", i, err)
+		}
+	}
+	for _, s := range steps {
+		if s.Name != "" || s.Method != "" {
+			t.Errorf("want shared step left unchanged, got %+v", s)
+		}
+	}
+}
+
+func TestStepsInvalid(t *testing.T) {
+	var invalidSets = []struct {
+		name    string
+		options []probe.Option
+	}{
+		{name: "probe payload", options: []probe.Option{probe.WithSteps(probe.Step{URL: "/a"}), probe.WithPayload("{}")}},
+		{name: "url template", options: []probe.Option{probe.WithSteps(probe.Step{URL: "/a/{{.id"})}},
+		{name: "payload template", options: []probe.Option{probe.WithSteps(probe.Step{URL: "/a", Payload: "{{nope}}"})}},
+		{name: "header template", options: []probe.Option{probe.WithSteps(probe.Step{URL: "/a", Headers: map[string]string{"Authorization": "Bearer {{.token"}})}},
+	}
+	for _, is := range invalidSets {
+		options := append([]probe.Option{
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		}, is.options...)
+		p, err := probe.New("http://example.invalid", options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", is.name, err)
+		}
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: want error", is.name)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	res := &probe.Result{
+		Body:    `{"a": {"b": [10, {"c": "deep"}]}, "n": 1.5}`,
+		Headers: http.Header{"X-Token": {"hdr"}},
+	}
+
+	var extractSets = []struct {
+		expr  string
+		value string
+		ok    bool
+	}{
+		{expr: "json:a.b.1.c", value: "deep", ok: true},
+		{expr: "json:a.b.0", value: "10", ok: true},
+		{expr: "json:n", value: "1.5", ok: true},
+		{expr: "json:a.b", value: `[10,{"c":"deep"}]`, ok: true},
+		{expr: "header:X-Token", value: "hdr", ok: true},
+		{expr: `regex:"c": "(\w+)"`, value: "deep", ok: true},
+		{expr: "json:a.missing", ok: false},
+		{expr: "json:a.b.5", ok: false},
+		{expr: "header:X-Missing", ok: false},
+		{expr: "xpath://a", ok: false},
+	}
+
+	for _, es := range extractSets {
+		v, err := probe.Extract(res, es.expr)
+		if (err == nil) != es.ok || v != es.value {
+			t.Errorf("%s: want %q ok=%t, got %q %v", es.expr, es.value, es.ok, v, err)
+		}
+	}
+}
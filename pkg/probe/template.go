@@ -0,0 +1,149 @@
+package probe
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the functions available to request templates,
+// evaluated afresh on every check:
+//
+//	now               the current time, e.g. {{now.Unix}} or {{now.Format "2006-01-02"}}
+//	ago "1h"          the current time less a duration, for time-bounded queries
+//	uuid              a random version 4 UUID, e.g. for idempotency keys
+//	randInt 1 100     a random integer in [min, max)
+//	randString 16     a random alphanumeric string of the given length
+var templateFuncs = template.FuncMap{
+	"now": time.Now,
+	"ago": func(d string) (time.Time, error) {
+		parsed, err := time.ParseDuration(d)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Now().Add(-parsed), nil
+	},
+	"uuid":       uuid,
+	"randInt":    randInt,
+	"randString": randString,
+}
+
+// secretFuncs are the functions which are also available to the
+// request templates of probes made with WithTemplateSecrets:
+//
+//	env "NAME"        the value of an environment variable
+//	secret "path"     the contents of a file, less any trailing newline
+var secretFuncs = template.FuncMap{
+	"env": os.Getenv,
+	"secret": func(path string) (string, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	},
+}
+
+// parseTemplate parses text as a request template, which may use
+// the secretFuncs if secrets is set
+func parseTemplate(text string, secrets bool) (*template.Template, error) {
+	t := template.New("").Funcs(templateFuncs)
+	if secrets {
+		t = t.Funcs(secretFuncs)
+	}
+	t, err := t.Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", ErrInvalidTemplate, err)
+	}
+	return t, nil
+}
+
+// render executes text as a template with the variables as data,
+// so that {{.name}} is replaced by the value of the variable name.
+// Text without any actions is returned as is.
+func render(text string, vars map[string]string, secrets bool) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	t, err := parseTemplate(text, secrets)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// WithTemplateSecrets makes the env and secret functions available to
+// the probe's request templates, so that credentials can be read from
+// the environment or from files. Templates which come from anywhere
+// but a trusted configuration must never be given to such a probe.
+func WithTemplateSecrets() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.templateSecrets = true
+		return nil
+	}
+}
+
+// WithLiteralEndpoint uses the probe's endpoint exactly as given
+// rather than as a request template, for endpoints which come from
+// an untrusted source such as a request to the /probe endpoint
+func WithLiteralEndpoint() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.literalEndpoint = true
+		return nil
+	}
+}
+
+// uuid returns a random version 4 UUID
+func uuid() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randInt returns a random integer in [min, max)
+func randInt(min int, max int) (int, error) {
+	if max <= min {
+		return 0, fmt.Errorf("randInt: max %d must be greater than min %d", max, min)
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+	if err != nil {
+		return 0, err
+	}
+	return min + int(n.Int64()), nil
+}
+
+// randAlphabet is the set of characters used by randString
+const randAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randString returns a random alphanumeric string of length n
+func randString(n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(len(randAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = randAlphabet[j.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,137 @@
+package probe_test
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+func TestRequestTemplates(t *testing.T) {
+	var bodies, keys, paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		paths = append(paths, r.URL.RequestURI())
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "alien")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(secret, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ALIEN_TEST_REGION", "eu")
+	defer os.Unsetenv("ALIEN_TEST_REGION")
+
+	p, err := probe.New(srv.URL+`/search?region={{env "ALIEN_TEST_REGION"}}`,
+		probe.WithMethod(http.MethodPost),
+		probe.WithHeader("Idempotency-Key", "{{uuid}}"),
+		probe.WithTemplateSecrets(),
+		probe.WithPayload(`{"token": "{{secret "`+secret+`"}}", "n": {{randInt 5 6}}, "id": "{{randString 8}}", "since": {{(ago "1h").Unix}}}`),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := p.Check(context.Background())
+		if err != nil || !res.Success {
+			t.Fatalf("Check: %v %+v", err, res)
+		}
+	}
+
+	uuidRE := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuidRE.MatchString(keys[0]) || keys[0] == keys[1] {
+		t.Errorf("want a fresh UUID each check, got %v", keys)
+	}
+	if paths[0] != "/search?region=eu" {
+		t.Errorf("want endpoint rendered, got %s", paths[0])
+	}
+	bodyRE := regexp.MustCompile(`^\{"token": "s3cret", "n": 5, "id": "[a-zA-Z0-9]{8}", "since": \d+\}$`)
+	if !bodyRE.MatchString(bodies[0]) {
+		t.Errorf("unexpected body %s", bodies[0])
+	}
+}
+
+func TestRequestTemplatesInvalid(t *testing.T) {
+	p, err := probe.New("http://example.invalid",
+		probe.WithPayload("{{uuid"),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	if err := p.Validate(); err == nil || !strings.HasPrefix(err.Error(), probe.ErrInvalidTemplate.Error()) {
+		t.Errorf("want %v, got %v", probe.ErrInvalidTemplate, err)
+	}
+
+	p, err = probe.New("http://example.invalid",
+		probe.WithPayload(`{{secret "/nonexistent/secret"}}`),
+		probe.WithTemplateSecrets(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	res, err := p.Check(context.Background())
+	if err != nil || res.Error == nil {
+		t.Errorf("want check error for missing secret, got %v %v", err, res.Error)
+	}
+}
+
+func TestRequestTemplatesSecrets(t *testing.T) {
+	// Without WithTemplateSecrets, env and secret are not available
+	for _, template := range []string{`{{env "HOME"}}`, `{{secret "/etc/hostname"}}`} {
+		p, err := probe.New("http://example.invalid/"+template,
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		if err != nil {
+			t.Fatalf("New probe: %v", err)
+		}
+		if err := p.Validate(); err == nil || !strings.HasPrefix(err.Error(), probe.ErrInvalidTemplate.Error()) {
+			t.Errorf("%s: want %v, got %v", template, probe.ErrInvalidTemplate, err)
+		}
+	}
+}
+
+func TestLiteralEndpoint(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	p, err := probe.New(srv.URL+"/{{uuid}}",
+		probe.WithLiteralEndpoint(),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	if _, err := p.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/{{uuid}}" {
+		t.Errorf("want endpoint requested as given, got %v", paths)
+	}
+}
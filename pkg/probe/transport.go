@@ -0,0 +1,196 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newTransport returns a transport for a single probe, so that
+// settings such as TLS and timeouts do not leak between probes.
+// Connections are made with the probe's dial method.
+func (p *Probe) newTransport() *http.Transport {
+	p.dialer = &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{}
+	t.DialContext = p.dial
+	t.Proxy = p.proxyFor
+	t.OnProxyConnectResponse = p.proxyConnectResponse
+	return t
+}
+
+// dial makes a connection for the probe's transport, using the
+// preferred IP version if one is set
+func (p *Probe) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if p.network != "" {
+		network = p.network
+	}
+	return p.dialProxy(ctx, network, addr)
+}
+
+// WithKeepAlive sets whether connections are kept open to be
+// reused by later checks
+//
+// If not used, connections are kept alive
+func WithKeepAlive(enabled bool) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.DisableKeepAlives = !enabled
+		return nil
+	}
+}
+
+// WithFreshConnections closes any idle connections before each
+// check, so that every check includes the time to connect. Unlike
+// WithKeepAlive(false), steps within a check may still share a
+// connection.
+func WithFreshConnections() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.fresh = true
+		return nil
+	}
+}
+
+// WithHTTP2 sets whether HTTP/2 is negotiated with endpoints
+// which support it
+//
+// If not used, HTTP/2 is enabled
+func WithHTTP2(enabled bool) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.ForceAttemptHTTP2 = enabled
+		if !enabled {
+			p.transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+		return nil
+	}
+}
+
+// WithIPVersion restricts connections to IPv4 (4) or IPv6 (6)
+//
+// If not used, either is used as the endpoint resolves
+func WithIPVersion(version int) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		switch version {
+		case 4:
+			p.network = "tcp4"
+		case 6:
+			p.network = "tcp6"
+		default:
+			return fmt.Errorf("%v: %d", ErrInvalidIPVersion, version)
+		}
+		return nil
+	}
+}
+
+// WithSourceAddress makes connections from the given local IP address
+func WithSourceAddress(address string) Option {
+	return func(p *Probe) error {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return fmt.Errorf("%v: %q", ErrInvalidSourceAddress, address)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		return nil
+	}
+}
+
+// WithDialTimeout sets how long to wait for a connection to be
+// made, separately from the overall timeout set by WithClient
+//
+// If not used, the default is 30 seconds
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.dialer.Timeout = timeout
+		return nil
+	}
+}
+
+// WithTLSCA trusts the CA certificates in the PEM file when
+// verifying the endpoint's certificate, instead of the system roots
+func WithTLSCA(caFile string) Option {
+	return func(p *Probe) error {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%v: no certificates in %s", ErrInvalidTLS, caFile)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.TLSClientConfig.RootCAs = pool
+		return nil
+	}
+}
+
+// WithTLSClientCert presents the certificate and key in the PEM
+// files to the endpoint, for mutual TLS
+func WithTLSClientCert(certFile string, keyFile string) Option {
+	return func(p *Probe) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("%v: %v", ErrInvalidTLS, err)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// WithTLSServerName sets the server name sent with SNI and used to
+// verify the endpoint's certificate, instead of the endpoint host
+func WithTLSServerName(name string) Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.TLSClientConfig.ServerName = name
+		return nil
+	}
+}
+
+// WithTLSMinVersion sets the lowest TLS version the probe accepts,
+// such as tls.VersionTLS12
+func WithTLSMinVersion(version uint16) Option {
+	return func(p *Probe) error {
+		if version < tls.VersionTLS10 || version > tls.VersionTLS13 {
+			return fmt.Errorf("%v: unknown version %#x", ErrInvalidTLS, version)
+		}
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.TLSClientConfig.MinVersion = version
+		return nil
+	}
+}
+
+// WithTLSInsecureSkipVerify accepts any certificate from the
+// endpoint. This should only be used for testing.
+func WithTLSInsecureSkipVerify() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.transport.TLSClientConfig.InsecureSkipVerify = true
+		return nil
+	}
+}
@@ -0,0 +1,274 @@
+package probe_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// testPKI is a throwaway CA with a server and client certificate
+// written out as PEM files
+type testPKI struct {
+	dir        string
+	pool       *x509.CertPool
+	server     tls.Certificate
+	caFile     string
+	clientCert string
+	clientKey  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	dir, err := ioutil.TempDir("", "alien-pki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pki := &testPKI{dir: dir, pool: x509.NewCertPool()}
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "alien test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	pki.pool.AddCert(ca)
+	pki.caFile = pki.write(t, "ca.pem", "CERTIFICATE", caDER)
+
+	issue := func(serial int64, tmpl *x509.Certificate) ([]byte, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl.SerialNumber = big.NewInt(serial)
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+		tmpl.NotAfter = time.Now().Add(time.Hour)
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+
+	serverDER, serverKey := issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "probe.test"},
+		DNSNames:    []string{"probe.test"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pki.server = tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey}
+
+	clientDER, clientKey := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "alien"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	keyDER, _ := x509.MarshalECPrivateKey(clientKey)
+	pki.clientCert = pki.write(t, "client.pem", "CERTIFICATE", clientDER)
+	pki.clientKey = pki.write(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+
+	return pki
+}
+
+func (pki *testPKI) write(t *testing.T, name string, kind string, der []byte) string {
+	path := filepath.Join(pki.dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	defer os.RemoveAll(pki.dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	var tlsSets = []struct {
+		name    string
+		options []probe.Option
+		pass    bool
+	}{
+		{name: "system roots", options: nil, pass: false},
+		{name: "no client cert", options: []probe.Option{
+			probe.WithTLSCA(pki.caFile),
+			probe.WithTLSServerName("probe.test"),
+		}, pass: false},
+		{name: "wrong server name", options: []probe.Option{
+			probe.WithTLSCA(pki.caFile),
+			probe.WithTLSClientCert(pki.clientCert, pki.clientKey),
+		}, pass: false},
+		{name: "mutual TLS", options: []probe.Option{
+			probe.WithTLSCA(pki.caFile),
+			probe.WithTLSClientCert(pki.clientCert, pki.clientKey),
+			probe.WithTLSServerName("probe.test"),
+			probe.WithTLSMinVersion(tls.VersionTLS12),
+		}, pass: true},
+		{name: "skip verify", options: []probe.Option{
+			probe.WithTLSClientCert(pki.clientCert, pki.clientKey),
+			probe.WithTLSInsecureSkipVerify(),
+		}, pass: true},
+	}
+
+	for _, ts := range tlsSets {
+		options := append(ts.options,
+			probe.WithSuccessFilter(probe.FilterResponseContains("alien")),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		p, err := probe.New(srv.URL, options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", ts.name, err)
+		}
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", ts.name, err)
+		}
+		if res.Success != ts.pass {
+			t.Errorf("%s: want success=%t, got %t (%v)", ts.name, ts.pass, res.Success, res.Error)
+		}
+	}
+}
+
+func TestClientIsolation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	quick, err := probe.New(srv.URL,
+		probe.WithClient(10*time.Millisecond),
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+	patient, err := probe.New(srv.URL,
+		probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+		probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+	)
+	if err != nil {
+		t.Fatalf("New probe: %v", err)
+	}
+
+	if res, _ := quick.Check(context.Background()); res.Success {
+		t.Errorf("want quick probe to time out")
+	}
+	if res, _ := patient.Check(context.Background()); !res.Success {
+		t.Errorf("want patient probe unaffected by other timeout, got %v", res.Error)
+	}
+	if http.DefaultClient.Timeout != 0 {
+		t.Errorf("http.DefaultClient timeout changed to %s", http.DefaultClient.Timeout)
+	}
+}
+
+func TestFreshConnections(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	var connSets = []struct {
+		name    string
+		options []probe.Option
+		conns   int32
+	}{
+		{name: "reused", options: nil, conns: 1},
+		{name: "fresh", options: []probe.Option{probe.WithFreshConnections()}, conns: 3},
+		{name: "no keep-alive", options: []probe.Option{probe.WithKeepAlive(false)}, conns: 3},
+	}
+
+	for _, cs := range connSets {
+		atomic.StoreInt32(&conns, 0)
+		options := append(cs.options,
+			probe.WithIPVersion(4),
+			probe.WithSourceAddress("127.0.0.1"),
+			probe.WithDialTimeout(time.Second),
+			probe.WithSuccessFilter(probe.FilterResponseCode(200)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		p, err := probe.New(srv.URL, options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", cs.name, err)
+		}
+		for i := 0; i < 3; i++ {
+			if res, _ := p.Check(context.Background()); !res.Success {
+				t.Fatalf("%s: check failed: %v", cs.name, res.Error)
+			}
+		}
+		if got := atomic.LoadInt32(&conns); got != cs.conns {
+			t.Errorf("%s: want %d connections, got %d", cs.name, cs.conns, got)
+		}
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for enabled, proto := range map[bool]string{true: "HTTP/2.0", false: "HTTP/1.1"} {
+		p, err := probe.New(srv.URL,
+			probe.WithHTTP2(enabled),
+			probe.WithTLSInsecureSkipVerify(),
+			probe.WithSuccessFilter(probe.FilterResponseContains(proto)),
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+		)
+		if err != nil {
+			t.Fatalf("New probe: %v", err)
+		}
+		if res, _ := p.Check(context.Background()); !res.Success {
+			t.Errorf("http2=%t: want %s, got %q %v", enabled, proto, res.Body, res.Error)
+		}
+	}
+}
+
+func TestTransportOptionsInvalid(t *testing.T) {
+	for _, o := range []probe.Option{
+		probe.WithIPVersion(5),
+		probe.WithSourceAddress("localhost"),
+		probe.WithTLSMinVersion(0x0200),
+	} {
+		if _, err := probe.New("http://example.invalid", o, probe.WithLogger(log.New(ioutil.Discard, "", 0))); err == nil {
+			t.Errorf("want error from invalid option")
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultUDPTimeout is how long to wait for a response when the
+// probe has no timeout set with WithClient
+const defaultUDPTimeout = 5 * time.Second
+
+// maxDatagramSize is the largest UDP payload which can be received
+const maxDatagramSize = 65535
+
+// doUDP sends the probe's payload in a datagram to the endpoint and
+// records the response on the given Result
+func (p *Probe) doUDP(ctx context.Context, res *Result) error {
+	endpoint, _, payload, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	addr := strings.TrimPrefix(endpoint, "udp://")
+
+	timeout := p.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultUDPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	network := "udp"
+	switch p.network {
+	case "tcp4":
+		network = "udp4"
+	case "tcp6":
+		network = "udp6"
+	}
+	// The source address set with WithSourceAddress is for TCP, and
+	// must be given as a UDP address to dial UDP from it
+	dialer := *p.dialer
+	if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok {
+		dialer.LocalAddr = &net.UDPAddr{IP: local.IP}
+	}
+	conn, err := dialer.DialContext(ctx, network, p.dialAddress(ctx, addr))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	sent := time.Now()
+	if _, err := conn.Write([]byte(payload)); err != nil {
+		return fmt.Errorf("%w: %v", ErrUDP, err)
+	}
+
+	buf := make([]byte, maxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return fmt.Errorf("%w: no response within %s", ErrUDP, timeout)
+		}
+		return fmt.Errorf("%w: %v", ErrUDP, err)
+	}
+	res.RoundTrip = time.Since(sent)
+	res.Body = string(buf[:n])
+	return nil
+}
+
+// WithUDP makes the probe send its payload, set with WithPayload or
+// WithHexPayload, in a UDP datagram to the endpoint, which is
+// udp://host:port or host:port. The first datagram received in
+// response is the Body of the Result, which can be checked with
+// filters such as FilterResponseContains, and the time taken for it
+// to arrive is the RoundTrip of the Result.
+//
+// No response within the timeout set with WithClient, or else 5
+// seconds, or an ICMP port unreachable reply, is an ErrUDP error.
+func WithUDP() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.kind = "UDP"
+		p.checker = p.doUDP
+		return nil
+	}
+}
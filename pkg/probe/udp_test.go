@@ -0,0 +1,95 @@
+package probe_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// udpServer answers each datagram with "echo: " and its contents,
+// except for "quiet" which is not answered
+func udpServer(t *testing.T) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if string(buf[:n]) != "quiet" {
+				conn.WriteTo(append([]byte("echo: "), buf[:n]...), addr)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestUDP(t *testing.T) {
+	srv := udpServer(t)
+	defer srv.Close()
+	closed := udpServer(t)
+	closed.Close()
+
+	var udpSets = []struct {
+		name     string
+		endpoint string
+		options  []probe.Option
+		filter   probe.ResultFilter
+		success  bool
+		udpError bool
+	}{
+		{name: "text", endpoint: "udp://" + srv.LocalAddr().String(), options: []probe.Option{probe.WithPayload("hello")}, filter: probe.FilterResponseContains("echo: hello"), success: true},
+		{name: "hex", endpoint: srv.LocalAddr().String(), options: []probe.Option{probe.WithHexPayload("68 69\n21")}, filter: probe.FilterResponseContains("echo: hi!"), success: true},
+		{name: "hex replaced", endpoint: srv.LocalAddr().String(), options: []probe.Option{probe.WithHexPayload("68 69"), probe.WithPayload("hello")}, filter: probe.FilterResponseContains("echo: hello"), success: true},
+		{name: "source address", endpoint: srv.LocalAddr().String(), options: []probe.Option{probe.WithSourceAddress("127.0.0.1"), probe.WithPayload("hello")}, filter: probe.FilterResponseContains("echo: hello"), success: true},
+		{name: "unexpected response", endpoint: srv.LocalAddr().String(), options: []probe.Option{probe.WithPayload("hello")}, filter: probe.FilterResponseContains("goodbye")},
+		{name: "no response", endpoint: srv.LocalAddr().String(), options: []probe.Option{probe.WithPayload("quiet")}, filter: probe.FilterResponseContains("echo"), udpError: true},
+		{name: "refused", endpoint: closed.LocalAddr().String(), options: []probe.Option{probe.WithPayload("hello")}, filter: probe.FilterResponseContains("echo"), udpError: true},
+	}
+
+	for _, us := range udpSets {
+		options := append([]probe.Option{
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithUDP(),
+			probe.WithClient(200 * time.Millisecond),
+			probe.WithSuccessFilter(us.filter),
+		}, us.options...)
+		p, err := probe.New(us.endpoint, options...)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", us.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", us.name, err)
+		}
+		if us.udpError {
+			if !errors.Is(res.Error, probe.ErrUDP) {
+				t.Errorf("%s: want UDP error, got %v", us.name, res.Error)
+			}
+			continue
+		}
+		if res.Error != nil || res.Success != us.success {
+			t.Errorf("%s: want success %t, got %t %v (%q)", us.name, us.success, res.Success, res.Error, res.Body)
+		}
+		if res.RoundTrip <= 0 {
+			t.Errorf("%s: want round trip recorded, got %s", us.name, res.RoundTrip)
+		}
+	}
+}
+
+func TestHexPayloadInvalid(t *testing.T) {
+	if _, err := probe.New("udp://127.0.0.1:9", probe.WithUDP(), probe.WithHexPayload("not hex")); err == nil {
+		t.Errorf("want error for invalid hex payload")
+	}
+}
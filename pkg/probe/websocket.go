@@ -0,0 +1,286 @@
+package probe
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webSocketGUID is appended to the handshake key to compute the
+// accept header, see RFC 6455 1.3
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultWebSocketTimeout is how long to wait for a reply when the
+// probe has no timeout set with WithClient
+const defaultWebSocketTimeout = 10 * time.Second
+
+// webSocketCloseTimeout is how long to wait for the server to
+// respond to closing the connection
+const webSocketCloseTimeout = time.Second
+
+// WebSocket frame opcodes, see RFC 6455 5.2
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// errWebSocketClosed is returned reading a message when the server
+// closes the connection
+var errWebSocketClosed = fmt.Errorf("%w: closed by server", ErrWebSocket)
+
+// doWebSocket performs the WebSocket handshake, then sends the probe's
+// message if set and waits for a reply which passes the success filter
+func (p *Probe) doWebSocket(ctx context.Context, res *Result) error {
+	endpoint, headers, message, err := p.renderRequest()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	nonce := base64.StdEncoding.EncodeToString(key)
+
+	// The timeout covers the whole check, rather than being left to
+	// the client which would stop the connection being written to
+	timeout := p.client.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebSocketTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := *p.client
+	client.Timeout = 0
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	setHeaders(req, headers)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", nonce)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	start := time.Now()
+	resp, err := p.send(&client, req, res)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	res.Code = resp.StatusCode
+	res.Headers = resp.Header
+
+	sum := sha1.Sum([]byte(nonce + webSocketGUID))
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("%w: handshake responded %s", ErrWebSocket, resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return fmt.Errorf("%w: handshake accept key mismatch", ErrWebSocket)
+	}
+	res.Handshake = time.Since(start)
+
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return fmt.Errorf("%w: connection not upgraded", ErrWebSocket)
+	}
+
+	// Reading is abandoned by closing the connection, when the
+	// check is cancelled or there is no reply in time
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	if message != "" {
+		if err := writeFrame(conn, wsText, []byte(message)); err != nil {
+			return err
+		}
+		sent := time.Now()
+		for {
+			reply, err := readMessage(r, conn)
+			if err != nil {
+				if err != errWebSocketClosed {
+					err = fmt.Errorf("%w: no matching reply: %v", ErrWebSocket, err)
+				}
+				return err
+			}
+			res.Body = reply
+			if p.success.Check(res) {
+				res.RoundTrip = time.Since(sent)
+				break
+			}
+		}
+	}
+
+	// Close cleanly, waiting briefly for the server's close frame
+	writeFrame(conn, wsClose, []byte{0x03, 0xe8})
+	closing := time.AfterFunc(webSocketCloseTimeout, func() { conn.Close() })
+	defer closing.Stop()
+	for {
+		if _, err := readMessage(r, conn); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// writeFrame writes a single masked frame, as sent by clients
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n < 1<<16:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(n))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads a single frame, unmasking it if needed
+func readFrame(r *bufio.Reader) (fin bool, opcode byte, payload []byte, err error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0f
+
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext)
+	}
+	if n > maxBodySize {
+		return false, 0, nil, fmt.Errorf("%w: frame of %d bytes too large", ErrWebSocket, n)
+	}
+
+	var mask []byte
+	if head[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if mask != nil {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// readMessage reads the next text or binary message, joining any
+// fragments and answering pings while waiting
+func readMessage(r *bufio.Reader, w io.Writer) (string, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := readFrame(r)
+		if err != nil {
+			return "", err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := writeFrame(w, wsPong, payload); err != nil {
+				return "", err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			return "", errWebSocketClosed
+		case wsText, wsBinary, wsContinuation:
+			message = append(message, payload...)
+			if len(message) > maxBodySize {
+				return "", fmt.Errorf("%w: message too large", ErrWebSocket)
+			}
+		default:
+			return "", fmt.Errorf("%w: unknown opcode %#x", ErrWebSocket, opcode)
+		}
+
+		if fin {
+			return string(message), nil
+		}
+	}
+}
+
+// WithWebSocket makes the probe perform a WebSocket handshake with
+// the endpoint, which is ws://host/path or wss://host/path. When the
+// probe has a payload, set with WithPayload, it is sent as a text
+// message and the probe waits for a reply which passes the success
+// filter, with the text of the reply as the Body of the Result.
+// Other messages received while waiting are ignored. The connection
+// is then closed cleanly.
+//
+// The time taken by the handshake and for the reply to arrive are
+// recorded as the Handshake and RoundTrip of the Result. A failed
+// handshake, or no matching reply within the timeout set with
+// WithClient or else 10 seconds, is an ErrWebSocket error.
+func WithWebSocket() Option {
+	return func(p *Probe) error {
+		p.processing.Lock()
+		defer p.processing.Unlock()
+		p.kind = "WS"
+		p.checker = p.doWebSocket
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+package probe_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangrier/alien/pkg/probe"
+)
+
+// writeServerFrame writes an unmasked frame, as sent by servers
+func writeServerFrame(w io.Writer, opcode byte, payload string) {
+	w.Write(append([]byte{0x80 | opcode, byte(len(payload))}, payload...))
+}
+
+// readClientFrame reads a short masked frame, as sent by clients
+func readClientFrame(r *bufio.Reader) (byte, string, error) {
+	head := make([]byte, 6)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, "", err
+	}
+	payload := make([]byte, head[1]&0x7f)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, "", err
+	}
+	for i := range payload {
+		payload[i] ^= head[2+i%4]
+	}
+	return head[0] & 0x0f, string(payload), nil
+}
+
+// echoHandler upgrades to a WebSocket which pings the client, sends
+// an unrelated message, then echoes each message it receives
+func echoHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		buf.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+		buf.Flush()
+
+		writeServerFrame(conn, 0x9, "are you there")
+		writeServerFrame(conn, 0x1, "tick")
+		for {
+			opcode, payload, err := readClientFrame(buf.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case 0x1:
+				writeServerFrame(conn, 0x1, "echo: "+payload)
+			case 0xa:
+				if payload != "are you there" {
+					t.Errorf("want pong payload echoed, got %q", payload)
+				}
+			case 0x8:
+				writeServerFrame(conn, 0x8, payload)
+				return
+			}
+		}
+	})
+}
+
+func TestWebSocket(t *testing.T) {
+	srv := httptest.NewServer(echoHandler(t))
+	defer srv.Close()
+	endpoint := strings.Replace(srv.URL, "http://", "ws://", 1)
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+
+	var wsSets = []struct {
+		name     string
+		endpoint string
+		payload  string
+		filter   probe.ResultFilter
+		success  bool
+		wsError  bool
+	}{
+		{name: "handshake", endpoint: endpoint, filter: probe.FilterResponseCode(101), success: true},
+		{name: "echo", endpoint: endpoint, payload: "hello", filter: probe.FilterResponseContains("echo: hello"), success: true},
+		{name: "no matching reply", endpoint: endpoint, payload: "hello", filter: probe.FilterResponseContains("goodbye"), wsError: true},
+		{name: "not a websocket", endpoint: strings.Replace(plain.URL, "http://", "ws://", 1), filter: probe.FilterResponseCode(101), wsError: true},
+	}
+
+	for _, ws := range wsSets {
+		p, err := probe.New(ws.endpoint,
+			probe.WithLogger(log.New(ioutil.Discard, "", 0)),
+			probe.WithWebSocket(),
+			probe.WithPayload(ws.payload),
+			probe.WithClient(500*time.Millisecond),
+			probe.WithSuccessFilter(ws.filter),
+		)
+		if err != nil {
+			t.Fatalf("%s: New probe: %v", ws.name, err)
+		}
+
+		res, err := p.Check(context.Background())
+		if err != nil {
+			t.Fatalf("%s: Check: %v", ws.name, err)
+		}
+		if ws.wsError {
+			if !errors.Is(res.Error, probe.ErrWebSocket) {
+				t.Errorf("%s: want WebSocket error, got %v", ws.name, res.Error)
+			}
+			continue
+		}
+		if res.Error != nil || res.Success != ws.success {
+			t.Errorf("%s: want success %t, got %t %v (%q)", ws.name, ws.success, res.Success, res.Error, res.Body)
+		}
+		if res.Handshake <= 0 || (ws.payload != "" && res.RoundTrip <= 0) {
+			t.Errorf("%s: want latencies recorded, got handshake %s round trip %s", ws.name, res.Handshake, res.RoundTrip)
+		}
+	}
+}